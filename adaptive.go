@@ -0,0 +1,116 @@
+package zapgorm2
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// AdaptiveSlowThreshold configures WithAdaptiveSlowThreshold.
+type AdaptiveSlowThreshold struct {
+	// K is the number of standard deviations above the mean latency of a
+	// fingerprint from which a query is slow. Defaults to 3.
+	K float64
+	// Window is the number of recent queries the rolling mean and standard
+	// deviation mostly account for. Defaults to 100.
+	Window int
+	// MinSamples is the number of queries of a fingerprint needed before
+	// its adaptive threshold is used instead of SlowThreshold. Defaults to 30.
+	MinSamples int
+	// MinThreshold is a lower bound of the adaptive threshold, so that
+	// queries with very stable latencies are not flagged for tiny variations.
+	MinThreshold time.Duration
+	// MaxFingerprints bounds the number of fingerprints with statistics,
+	// the least recently seen ones being evicted. Defaults to 1000.
+	MaxFingerprints int
+}
+
+// WithAdaptiveSlowThreshold returns a copy of the logger flagging queries as
+// slow relatively to the latency of the previous queries sharing their
+// Fingerprint: a query is slow when it takes more than the rolling mean plus
+// K standard deviations.
+//
+// SlowThreshold is used for the fingerprints without enough samples yet. As
+// the SQL is needed to compute fingerprints, the SQL callback of GORM is
+// called for every traced query.
+func (l Logger) WithAdaptiveSlowThreshold(cfg AdaptiveSlowThreshold) Logger {
+	if cfg.K <= 0 {
+		cfg.K = 3
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 100
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 30
+	}
+	if cfg.MaxFingerprints <= 0 {
+		cfg.MaxFingerprints = 1000
+	}
+	l.adaptive = &adaptiveThresholds{
+		cfg:   cfg,
+		alpha: 2 / (float64(cfg.Window) + 1),
+		stats: newLRU(cfg.MaxFingerprints),
+	}
+	return l
+}
+
+type adaptiveThresholds struct {
+	cfg   AdaptiveSlowThreshold
+	alpha float64
+
+	mu    sync.Mutex
+	stats *lru
+}
+
+// latencyStats are the mean and variance of latencies, in nanoseconds,
+// exponentially weighted once more than Window latencies were observed.
+type latencyStats struct {
+	count    int
+	mean     float64
+	variance float64
+}
+
+// threshold returns the adaptive threshold of fingerprint, if enough queries
+// were observed for it.
+func (a *adaptiveThresholds) threshold(fingerprint string) (time.Duration, bool) {
+	a.mu.Lock()
+	value, ok := a.stats.get(fingerprint)
+	a.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	stats := value.(latencyStats)
+	if stats.count < a.cfg.MinSamples {
+		return 0, false
+	}
+	threshold := time.Duration(stats.mean + a.cfg.K*math.Sqrt(stats.variance))
+	if threshold < a.cfg.MinThreshold {
+		threshold = a.cfg.MinThreshold
+	}
+	return threshold, true
+}
+
+func (a *adaptiveThresholds) observe(fingerprint string, elapsed time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	x := float64(elapsed)
+	value, ok := a.stats.get(fingerprint)
+	if !ok {
+		a.stats.add(fingerprint, latencyStats{count: 1, mean: x})
+		return
+	}
+	stats := value.(latencyStats)
+	diff := x - stats.mean
+	stats.count++
+	if stats.count <= a.cfg.Window {
+		// cumulative statistics until the window is filled, which avoids
+		// the bias of a moving average starting from a single sample.
+		n := float64(stats.count)
+		stats.mean += diff / n
+		stats.variance = ((n-1)*stats.variance + diff*(x-stats.mean)) / n
+	} else {
+		stats.mean += a.alpha * diff
+		stats.variance = (1 - a.alpha) * (stats.variance + a.alpha*diff*diff)
+	}
+	a.stats.add(fingerprint, stats)
+}
@@ -0,0 +1,39 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"moul.io/zapgorm2"
+)
+
+func TestAdaptiveSlowThreshold(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger).WithAdaptiveSlowThreshold(zapgorm2.AdaptiveSlowThreshold{
+		K:          3,
+		MinSamples: 10,
+	})
+	ctx := context.Background()
+	trace := func(sql string, elapsed time.Duration) {
+		logger.Trace(ctx, time.Now().Add(-elapsed), func() (string, int64) { return sql, 1 }, nil)
+	}
+
+	for i := 0; i < 20; i++ {
+		trace("SELECT * FROM users WHERE id = 1", time.Duration(9+i%3)*time.Millisecond)
+	}
+	require.Equal(t, 0, logs.Len())
+
+	trace("SELECT * FROM users WHERE id = 2", 10*time.Millisecond)
+	require.Equal(t, 0, logs.Len())
+	trace("SELECT * FROM users WHERE id = 3", 50*time.Millisecond)
+	require.Equal(t, 1, logs.Len(), "relatively slow for its fingerprint, below SlowThreshold")
+	require.Equal(t, zap.WarnLevel, logs.All()[0].Level)
+
+	trace("SELECT * FROM posts", 50*time.Millisecond)
+	require.Equal(t, 1, logs.Len(), "unknown fingerprints fall back to SlowThreshold")
+	trace("SELECT * FROM posts", 200*time.Millisecond)
+	require.Equal(t, 2, logs.Len())
+}
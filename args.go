@@ -0,0 +1,216 @@
+package zapgorm2
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// sqlArgs returns the bound variables of the statement traced with ctx, as
+// made available by RegisterCallbacks.
+func sqlArgs(ctx context.Context) ([]interface{}, bool) {
+	stmt := statementFromContext(ctx)
+	if stmt == nil {
+		return nil, false
+	}
+	return stmt.Vars, true
+}
+
+// driverValue returns the driver value of arg when it implements
+// driver.Valuer, or else arg. Like GORM's ExplainSQL, it returns nil for the
+// nil pointers, whose Value method may not accept a nil receiver, like
+// (*sql.NullString)(nil).
+func driverValue(arg interface{}) interface{} {
+	valuer, ok := arg.(driver.Valuer)
+	if !ok {
+		return arg
+	}
+	if rv := reflect.ValueOf(arg); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	if v, err := valuer.Value(); err == nil {
+		return v
+	}
+	return arg
+}
+
+// formatArgs serializes args as a JSON array, using the driver value of the
+// args implementing driver.Valuer.
+func formatArgs(args []interface{}) string {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = driverValue(arg)
+	}
+	out, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprint(values)
+	}
+	return string(out)
+}
+
+func (l Logger) argsFields(args []interface{}) []zapcore.Field {
+	serialized := formatArgs(args)
+	if l.MaxArgsLength <= 0 || len(serialized) <= l.MaxArgsLength {
+		return []zapcore.Field{zap.String("args", serialized)}
+	}
+	return []zapcore.Field{
+		zap.String("args", truncateString(serialized, l.MaxArgsLength)),
+		zap.Bool("args_truncated", true),
+	}
+}
+
+// truncateString cuts s to at most n bytes without splitting a rune.
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// inlineSQL returns sql with its ? and $n placeholders replaced by the
+// literals of args.
+func inlineSQL(sql string, args []interface{}) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	ordinal := 0
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(sql, i)
+			b.WriteString(sql[i:end])
+			i = end
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			end := commentEnd(sql, i)
+			b.WriteString(sql[i:end])
+			i = end
+		case c == '?' && ordinal < len(args):
+			b.WriteString(sqlLiteral(args[ordinal]))
+			ordinal++
+			i++
+		case c == '$' && i+1 < len(sql) && isDigitByte(sql[i+1]):
+			end, n := i+1, 0
+			for ; end < len(sql) && isDigitByte(sql[end]); end++ {
+				n = n*10 + int(sql[end]-'0')
+			}
+			if n >= 1 && n <= len(args) {
+				b.WriteString(sqlLiteral(args[n-1]))
+			} else {
+				b.WriteString(sql[i:end])
+			}
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// sqlLiteral renders arg as a SQL literal, quoting strings, byte slices and
+// times with single quotes.
+func sqlLiteral(arg interface{}) string {
+	arg = driverValue(arg)
+	if rv := reflect.ValueOf(arg); rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "NULL"
+		}
+		return sqlLiteral(rv.Elem().Interface())
+	}
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strconv.FormatBool(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return quoteSQLString(v.Format("2006-01-02 15:04:05.999999999Z07:00"))
+	case []byte:
+		return quoteSQLString(string(v))
+	case string:
+		return quoteSQLString(v)
+	}
+	return quoteSQLString(fmt.Sprint(arg))
+}
+
+func quoteSQLString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// maxArgsSummary is the number of args described by argsSummary.
+const maxArgsSummary = 32
+
+// argsSummary describes the type of args, without their value.
+func argsSummary(args []interface{}) string {
+	var b strings.Builder
+	for i, arg := range args {
+		if i == maxArgsSummary {
+			fmt.Fprintf(&b, ", ... (%d more)", len(args)-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(argSummary(arg))
+	}
+	return b.String()
+}
+
+func argSummary(arg interface{}) string {
+	arg = driverValue(arg)
+	switch v := arg.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string(" + strconv.Itoa(len(v)) + ")"
+	case []byte:
+		return "bytes(" + strconv.Itoa(len(v)) + ")"
+	case time.Time:
+		return "time"
+	}
+	rv := reflect.ValueOf(arg)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return "null"
+		}
+		return argSummary(rv.Elem().Interface())
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice, reflect.Array:
+		return "slice(" + strconv.Itoa(rv.Len()) + ")"
+	}
+	return fmt.Sprintf("%T", arg)
+}
+
+// paramsHash returns the hex-encoded SHA-256 of args serialized by
+// formatArgs, which is stable for equal args.
+func paramsHash(args []interface{}) string {
+	sum := sha256.Sum256([]byte(formatArgs(args)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,125 @@
+package zapgorm2
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const defaultAsyncQueueSize = 1024
+
+// WithAsyncWriter returns a copy of the logger handing its entries to a
+// background goroutine, through a queue of at most size entries (1024 when
+// size is not positive), so that slow sinks do not delay the queries.
+//
+// When the queue is full, entries are dropped if AsyncDropOnFull is set at
+// the time WithAsyncWriter is called, or else the query waits for room; the
+// dropped entries are reported to OnLogDrop.
+// Entries are written in order, but they may be lost if the process exits
+// without calling Close, which writes the queued entries. The entries
+// logged after Close are written synchronously.
+func (l Logger) WithAsyncWriter(size int) Logger {
+	if size <= 0 {
+		size = defaultAsyncQueueSize
+	}
+	w := &asyncWriter{
+		queue:      make(chan asyncEntry, size),
+		dropOnFull: l.AsyncDropOnFull,
+		onDrop:     l.OnLogDrop,
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	l.async = w
+	l.ZapLogger = l.ZapLogger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &asyncCore{Core: c, w: w}
+	}))
+	return l
+}
+
+type asyncEntry struct {
+	core   zapcore.Core
+	entry  zapcore.Entry
+	fields []zapcore.Field
+}
+
+type asyncWriter struct {
+	queue      chan asyncEntry
+	dropOnFull bool
+	onDrop     func(dropped int)
+	dropped    int64
+	done       chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func (w *asyncWriter) run() {
+	for e := range w.queue {
+		_ = e.core.Write(e.entry, e.fields)
+		w.reportDrops()
+	}
+	w.reportDrops()
+	close(w.done)
+}
+
+// reportDrops calls onDrop with the entries dropped since its previous call.
+func (w *asyncWriter) reportDrops() {
+	if w.onDrop == nil {
+		return
+	}
+	if n := atomic.SwapInt64(&w.dropped, 0); n > 0 {
+		w.onDrop(int(n))
+	}
+}
+
+func (w *asyncWriter) write(e asyncEntry) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return e.core.Write(e.entry, e.fields)
+	}
+	if !w.dropOnFull {
+		w.queue <- e
+		return nil
+	}
+	select {
+	case w.queue <- e:
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+	}
+	return nil
+}
+
+// close writes the queued entries and stops the background goroutine.
+func (w *asyncWriter) close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+// asyncCore hands the entries written to Core to an asyncWriter.
+type asyncCore struct {
+	zapcore.Core
+	w *asyncWriter
+}
+
+func (c *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	return &asyncCore{Core: c.Core.With(fields), w: c.w}
+}
+
+func (c *asyncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *asyncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.w.write(asyncEntry{core: c.Core, entry: ent, fields: fields})
+}
@@ -0,0 +1,112 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"moul.io/zapgorm2"
+)
+
+// gatedCore blocks its writes until the gate is opened, signaling each of
+// them on entered.
+type gatedCore struct {
+	zapcore.Core
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (c *gatedCore) With(fields []zapcore.Field) zapcore.Core {
+	return &gatedCore{Core: c.Core.With(fields), entered: c.entered, gate: c.gate}
+}
+
+func (c *gatedCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *gatedCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	c.entered <- struct{}{}
+	<-c.gate
+	return c.Core.Write(ent, fields)
+}
+
+func TestAsyncWriterFlushesOnClose(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	logger := zapgorm2.New(zap.New(core)).WithAsyncWriter(100)
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	for i := 0; i < 50; i++ {
+		logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	}
+	require.NoError(t, logger.Close())
+	require.Equal(t, 50, logs.Len())
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 51, logs.Len(), "entries logged after Close are written synchronously")
+}
+
+func TestAsyncDropOnFull(t *testing.T) {
+	observed, logs := observer.New(zap.WarnLevel)
+	core := &gatedCore{Core: observed, entered: make(chan struct{}, 10), gate: make(chan struct{})}
+	logger := zapgorm2.New(zap.New(core))
+	logger.AsyncDropOnFull = true
+	logger = logger.WithAsyncWriter(1)
+	ctx := context.Background()
+
+	logger.Error(ctx, "first")
+	<-core.entered
+	logger.Error(ctx, "queued")
+	logger.Error(ctx, "dropped")
+	close(core.gate)
+	require.NoError(t, logger.Close())
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "first", logs.All()[0].Message)
+	require.Equal(t, "queued", logs.All()[1].Message)
+}
+
+func TestOnLogDrop(t *testing.T) {
+	observed, logs := observer.New(zap.WarnLevel)
+	core := &gatedCore{Core: observed, entered: make(chan struct{}, 10), gate: make(chan struct{})}
+	logger := zapgorm2.New(zap.New(core))
+	logger.AsyncDropOnFull = true
+	dropped := 0
+	logger.OnLogDrop = func(n int) { dropped += n }
+	logger = logger.WithAsyncWriter(1)
+	ctx := context.Background()
+
+	logger.Error(ctx, "first")
+	<-core.entered
+	logger.Error(ctx, "queued")
+	for i := 0; i < 3; i++ {
+		logger.Error(ctx, "dropped")
+	}
+	close(core.gate)
+	require.NoError(t, logger.Close())
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, 3, dropped)
+}
+
+// syncErrorCore fails its syncs.
+type syncErrorCore struct {
+	zapcore.Core
+}
+
+func (c syncErrorCore) Sync() error {
+	return errors.New("sync failed")
+}
+
+func TestAsyncWriterCloseSyncError(t *testing.T) {
+	observed, _ := observer.New(zap.WarnLevel)
+	require.NoError(t, zapgorm2.New(zap.New(syncErrorCore{observed})).Close(), "Close only syncs with WithAsyncWriter")
+
+	logger := zapgorm2.New(zap.New(syncErrorCore{observed})).WithAsyncWriter(10)
+	require.EqualError(t, logger.Close(), "sync failed")
+}
@@ -0,0 +1,122 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"moul.io/zapgorm2"
+)
+
+// countingWriter counts the bytes written by the JSON encoder.
+type countingWriter struct{ n int64 }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func (w *countingWriter) Sync() error { return nil }
+
+func newBenchmarkLogger() (zapgorm2.Logger, *countingWriter) {
+	w := &countingWriter{}
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	logger := zapgorm2.New(zap.New(zapcore.NewCore(enc, w, zap.DebugLevel)))
+	logger.SkipCallerLookup = true
+	return logger, w
+}
+
+// benchmarkSQL is a multi-line statement with a quote-heavy IN-list, typical
+// of what GORM produces for preloads.
+var benchmarkSQL = "SELECT *\n\t\tFROM `users`\n\t\tWHERE `users`.`name` IN (" +
+	strings.Repeat("'user''s name',\n\t\t\t", 50) + "'last')\n\t\tAND `users`.`deleted_at` IS NULL"
+
+func benchmarkTrace(b *testing.B, logger zapgorm2.Logger, w *countingWriter, sql string) {
+	ctx := context.Background()
+	begin := time.Now()
+	fc := func() (string, int64) { return sql, 1 }
+	err := errors.New("boom")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Trace(ctx, begin, fc, err)
+	}
+	b.ReportMetric(float64(w.n)/float64(b.N), "encoded-bytes/op")
+}
+
+func BenchmarkTrace(b *testing.B) {
+	b.Run("default", func(b *testing.B) {
+		logger, w := newBenchmarkLogger()
+		benchmarkTrace(b, logger, w, benchmarkSQL)
+	})
+	b.Run("compact-sql", func(b *testing.B) {
+		logger, w := newBenchmarkLogger()
+		logger.CompactSQL = true
+		benchmarkTrace(b, logger, w, benchmarkSQL)
+	})
+	b.Run("compact-mode", func(b *testing.B) {
+		logger, w := newBenchmarkLogger()
+		logger.CompactMode = true
+		benchmarkTrace(b, logger, w, benchmarkSQL)
+	})
+}
+
+// BenchmarkSQLField compares encoding a large SQL statement as zap.String
+// and as zap.ByteString over the same statement converted to bytes once,
+// outside of the loop. zap.String does not copy the string, while
+// zap.ByteString has to box the slice into the field's interface, so the
+// bytes cost one more allocation per entry instead of saving one.
+func BenchmarkSQLField(b *testing.B) {
+	sql := "INSERT INTO `events` (`payload`) VALUES " + strings.Repeat("('0123456789abcdef'),", 4096) + "('end')"
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	entry := zapcore.Entry{Message: "trace"}
+	run := func(b *testing.B, field func() zapcore.Field) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf, err := enc.EncodeEntry(entry, []zapcore.Field{field()})
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf.Free()
+		}
+	}
+	b.Run("string", func(b *testing.B) {
+		run(b, func() zapcore.Field { return zap.String("sql", sql) })
+	})
+	b.Run("bytes", func(b *testing.B) {
+		bytes := []byte(sql)
+		run(b, func() zapcore.Field { return zap.ByteString("sql", bytes) })
+	})
+}
+
+// BenchmarkTraceFieldMask measures the cost of building the fields of an
+// error entry with the full, default and minimal FieldMask.
+func BenchmarkTraceFieldMask(b *testing.B) {
+	masks := []struct {
+		name   string
+		fields zapgorm2.FieldMask
+	}{
+		{"full", ^zapgorm2.FieldMask(0)},
+		{"default", zapgorm2.FieldsDefault},
+		{"minimal", zapgorm2.FieldSQL | zapgorm2.FieldElapsed},
+	}
+	for _, m := range masks {
+		m := m
+		b.Run(m.name, func(b *testing.B) {
+			logger := zapgorm2.New(zap.NewNop())
+			logger.Fields = m.fields
+			begin := time.Now()
+			fc := func() (string, int64) { return benchmarkSQL, 1 }
+			err := errors.New("boom")
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.TraceFields(begin, fc, err)
+			}
+		})
+	}
+}
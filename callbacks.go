@@ -0,0 +1,122 @@
+package zapgorm2
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+const statementCallbackName = "zapgorm2:statement"
+
+type statementCtxKey struct{}
+
+// AttachTo makes l the logger of db and registers the callbacks the logger
+// features rely on, see RegisterCallbacks. Like RegisterCallbacks, it is
+// safe to call it several times on the same db.
+func (l Logger) AttachTo(db *gorm.DB) error {
+	db.Logger = l
+	return RegisterCallbacks(db)
+}
+
+// RegisterCallbacks registers on db the callbacks giving the logger access
+// to the GORM statement of traced queries, which features like LogSQLArgs
+// rely on. It is safe to call it several times on the same db.
+func RegisterCallbacks(db *gorm.DB) error {
+	cb := db.Callback()
+	processors := []struct {
+		callback string
+		get      func(name string) func(*gorm.DB)
+		register func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Get, cb.Create().Before("*").Register},
+		{"query", cb.Query().Get, cb.Query().Before("*").Register},
+		{"update", cb.Update().Get, cb.Update().Before("*").Register},
+		{"delete", cb.Delete().Get, cb.Delete().Before("*").Register},
+		{"row", cb.Row().Get, cb.Row().Before("*").Register},
+		{"raw", cb.Raw().Get, cb.Raw().Before("*").Register},
+	}
+	for _, p := range processors {
+		if p.get(statementCallbackName) != nil {
+			continue
+		}
+		if err := p.register(statementCallbackName, stashStatement(p.callback)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type stashedStatement struct {
+	stmt     *gorm.Statement
+	callback string
+}
+
+// stashStatement returns a callback storing the statement and the name of
+// the callback processor in the statement context, which GORM hands to
+// Trace once the statement is executed.
+func stashStatement(callback string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if stashed, ok := ctx.Value(statementCtxKey{}).(stashedStatement); ok && stashed.stmt == db.Statement && stashed.callback == callback {
+			return
+		}
+		db.Statement.Context = context.WithValue(ctx, statementCtxKey{}, stashedStatement{stmt: db.Statement, callback: callback})
+	}
+}
+
+func statementFromContext(ctx context.Context) *gorm.Statement {
+	if ctx == nil {
+		return nil
+	}
+	stashed, _ := ctx.Value(statementCtxKey{}).(stashedStatement)
+	return stashed.stmt
+}
+
+// callbackFromContext returns the name of the GORM callback processor that
+// ran the statement traced with ctx: create, query, update, delete, row or
+// raw.
+func callbackFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	stashed, _ := ctx.Value(statementCtxKey{}).(stashedStatement)
+	return stashed.callback
+}
+
+type modelCtxKey struct{}
+
+// ContextWithModel returns a context in which the queries are logged with
+// model as their model field with LogModel, e.g. for raw SQL, for which GORM
+// knows no model.
+func ContextWithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelCtxKey{}, model)
+}
+
+// modelFromContext returns the model given to ContextWithModel, or else the
+// name of the model of the GORM statement traced with ctx.
+func modelFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if model, ok := ctx.Value(modelCtxKey{}).(string); ok {
+		return model
+	}
+	stmt := statementFromContext(ctx)
+	switch {
+	case stmt == nil:
+		return ""
+	case stmt.Schema != nil:
+		return stmt.Schema.Name
+	case stmt.Model != nil:
+		t := reflect.TypeOf(stmt.Model)
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		}
+		return t.Name()
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package zapgorm2
+
+import (
+	"reflect"
+	"runtime/debug"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// NewFromGormConfig is like New, with the settings of the logger of cfg
+// carried over, so that they are configured once: the LogLevel,
+// SlowThreshold and IgnoreRecordNotFoundError of a logger created by gorm's
+// logger.New or of a zapgorm2 Logger. The defaults of New are kept for the
+// settings cfg doesn't expose, e.g. when cfg or its logger is nil.
+func NewFromGormConfig(zapLogger *zap.Logger, cfg *gorm.Config) Logger {
+	l := New(zapLogger)
+	if cfg == nil || cfg.Logger == nil {
+		return l
+	}
+	var c gormlogger.Config
+	switch v := cfg.Logger.(type) {
+	case Logger:
+		c = gormlogger.Config{LogLevel: v.LogLevel, SlowThreshold: v.SlowThreshold, IgnoreRecordNotFoundError: v.IgnoreRecordNotFoundError}
+	case *Logger:
+		if v == nil {
+			return l
+		}
+		c = gormlogger.Config{LogLevel: v.LogLevel, SlowThreshold: v.SlowThreshold, IgnoreRecordNotFoundError: v.IgnoreRecordNotFoundError}
+	default:
+		var ok bool
+		if c, ok = gormLoggerConfig(cfg.Logger); !ok {
+			return l
+		}
+	}
+	l.LogLevel = c.LogLevel
+	l.SlowThreshold = c.SlowThreshold
+	l.IgnoreRecordNotFoundError = c.IgnoreRecordNotFoundError
+	return l
+}
+
+// NewWithBuildInfo is like New, with Version set to the version of the main
+// module of the binary, as reported by runtime/debug.ReadBuildInfo. Version
+// is left empty when the binary has no build information or is a
+// development build.
+func NewWithBuildInfo(zapLogger *zap.Logger) Logger {
+	l := New(zapLogger)
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "(devel)" {
+		l.Version = info.Main.Version
+	}
+	return l
+}
+
+// gormLoggerConfig returns the logger.Config embedded in the logger returned
+// by gorm's logger.New, whose type is unexported.
+func gormLoggerConfig(l gormlogger.Interface) (gormlogger.Config, bool) {
+	v := reflect.ValueOf(l)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return gormlogger.Config{}, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return gormlogger.Config{}, false
+	}
+	f := v.FieldByName("Config")
+	if !f.IsValid() || !f.CanInterface() {
+		return gormlogger.Config{}, false
+	}
+	c, ok := f.Interface().(gormlogger.Config)
+	return c, ok
+}
@@ -0,0 +1,86 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"moul.io/zapgorm2"
+)
+
+func TestVersion(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.Version = "v1.2.3"
+	ctx := context.Background()
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+	logger.Warn(ctx, "warning")
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "v1.2.3", logs.All()[0].ContextMap()["app_version"])
+	require.Equal(t, "v1.2.3", logs.All()[1].ContextMap()["app_version"])
+}
+
+func TestNewWithBuildInfo(t *testing.T) {
+	logger := zapgorm2.NewWithBuildInfo(zap.NewNop())
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "(devel)" {
+		require.Empty(t, logger.Version)
+		return
+	}
+	require.Equal(t, info.Main.Version, logger.Version)
+}
+
+func TestNewFromGormConfig(t *testing.T) {
+	zaplogger := zap.NewNop()
+	defaults := zapgorm2.New(zaplogger)
+
+	tests := []struct {
+		name           string
+		cfg            *gorm.Config
+		level          gormlogger.LogLevel
+		slowThreshold  time.Duration
+		ignoreNotFound bool
+	}{
+		{"nil config", nil, defaults.LogLevel, defaults.SlowThreshold, false},
+		{"nil logger", &gorm.Config{}, defaults.LogLevel, defaults.SlowThreshold, false},
+		{"nil zapgorm2 logger", &gorm.Config{Logger: (*zapgorm2.Logger)(nil)}, defaults.LogLevel, defaults.SlowThreshold, false},
+		{
+			"gorm logger",
+			&gorm.Config{Logger: gormlogger.New(log.New(os.Stderr, "", 0), gormlogger.Config{
+				LogLevel:                  gormlogger.Info,
+				SlowThreshold:             time.Second,
+				IgnoreRecordNotFoundError: true,
+			})},
+			gormlogger.Info, time.Second, true,
+		},
+		{
+			"gorm logger with level",
+			&gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)},
+			gormlogger.Silent, 200 * time.Millisecond, false,
+		},
+		{
+			"zapgorm2 logger",
+			&gorm.Config{Logger: zapgorm2.New(zaplogger).LogMode(gormlogger.Error)},
+			gormlogger.Error, defaults.SlowThreshold, false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			l := zapgorm2.NewFromGormConfig(zaplogger, tt.cfg)
+			require.Equal(t, zaplogger, l.ZapLogger)
+			require.Equal(t, tt.level, l.LogLevel)
+			require.Equal(t, tt.slowThreshold, l.SlowThreshold)
+			require.Equal(t, tt.ignoreNotFound, l.IgnoreRecordNotFoundError)
+		})
+	}
+}
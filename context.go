@@ -0,0 +1,163 @@
+package zapgorm2
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+)
+
+type migrationCtxKey struct{}
+
+// ContextForMigration marks ctx so that queries traced with it carry a
+// migration=true field, e.g. db.WithContext(ContextForMigration(ctx)).AutoMigrate(...).
+func ContextForMigration(ctx context.Context) context.Context {
+	return context.WithValue(ctx, migrationCtxKey{}, true)
+}
+
+func isMigrationContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	migration, _ := ctx.Value(migrationCtxKey{}).(bool)
+	return migration
+}
+
+type attemptCtxKey struct{}
+
+// ContextWithAttempt records in ctx that queries run with it are the n-th
+// attempt of a retried operation, logged as an attempt field by Trace.
+// Retry wrappers should call it before each attempt, starting at 1.
+func ContextWithAttempt(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, attemptCtxKey{}, n)
+}
+
+// AttemptFromContext returns the attempt number set by ContextWithAttempt.
+func AttemptFromContext(ctx context.Context) (int, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	n, ok := ctx.Value(attemptCtxKey{}).(int)
+	return n, ok
+}
+
+type silencedCtxKey struct{}
+
+// ContextSilenced returns a context disabling all the entries of the loggers
+// it is given to, e.g. db.WithContext(ContextSilenced(ctx)) for a noisy batch
+// job. Like with Enabled, the callbacks (Metrics, OnSlowQuery, ...) keep
+// being called.
+func ContextSilenced(ctx context.Context) context.Context {
+	return context.WithValue(ctx, silencedCtxKey{}, true)
+}
+
+func isSilencedContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	silenced, _ := ctx.Value(silencedCtxKey{}).(bool)
+	return silenced
+}
+
+type correlationCtxKey struct{}
+
+// correlationID is generated on first use, so that requests running no
+// query do not pay for it.
+type correlationID struct {
+	once sync.Once
+	id   string
+}
+
+func (c *correlationID) get() string {
+	c.once.Do(func() {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err == nil {
+			c.id = hex.EncodeToString(b[:])
+		}
+	})
+	return c.id
+}
+
+// ContextWithCorrelationID returns a context carrying a random correlation
+// ID, generated on first use, logged as a correlation_id field on the
+// entries of the loggers with GenerateCorrelationID. It is typically called
+// once per request; a context already carrying an ID keeps it.
+func ContextWithCorrelationID(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(correlationCtxKey{}).(*correlationID); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationCtxKey{}, &correlationID{})
+}
+
+// CorrelationIDFromContext returns the correlation ID of a context returned
+// by ContextWithCorrelationID, generating it if needed.
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	c, ok := ctx.Value(correlationCtxKey{}).(*correlationID)
+	if !ok {
+		return "", false
+	}
+	id := c.get()
+	return id, id != ""
+}
+
+type rawSQLCtxKey struct{}
+
+// ContextForRawSQL marks ctx as running raw SQL, for RowsModeSkipRaw, e.g.
+// db.WithContext(ContextForRawSQL(ctx)).Exec(...). The logger cannot tell
+// Raw and Exec calls from the other ones by itself.
+func ContextForRawSQL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rawSQLCtxKey{}, true)
+}
+
+func isRawSQLContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	raw, _ := ctx.Value(rawSQLCtxKey{}).(bool)
+	return raw
+}
+
+type requestCtxKey struct{}
+
+// requestState is the number of the queries of a request still to be logged
+// verbosely after an error.
+type requestState struct {
+	verbose int32
+}
+
+// ContextForRequest returns a context in which the queries following a failed
+// query are logged verbosely, for PostErrorVerboseCount. It is meant to wrap
+// the context of a single request, e.g. in an HTTP middleware.
+func ContextForRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestCtxKey{}, &requestState{})
+}
+
+// afterRequestError records a failed query of the request of ctx, and reports
+// for the other queries whether they are among the count following the last
+// failure.
+func afterRequestError(ctx context.Context, failed bool, count int) bool {
+	if ctx == nil {
+		return false
+	}
+	state, ok := ctx.Value(requestCtxKey{}).(*requestState)
+	if !ok {
+		return false
+	}
+	if failed {
+		atomic.StoreInt32(&state.verbose, int32(count))
+		return false
+	}
+	for {
+		n := atomic.LoadInt32(&state.verbose)
+		if n <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&state.verbose, n, n-1) {
+			return true
+		}
+	}
+}
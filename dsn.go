@@ -0,0 +1,165 @@
+package zapgorm2
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// NewForDB is like New, with Host and Port parsed from the DSN of dialector,
+// e.g. the one passed to gorm.Open. Parsing is best-effort: URLs like
+// postgres://host:5432/db, Postgres key/value DSNs like "host=db port=5432"
+// and MySQL DSNs like "user@tcp(db:3306)/app" are supported for the
+// dialectors with a DSN field, like the MySQL and Postgres ones. Host and
+// Port are left empty otherwise, and can be set explicitly afterwards.
+func NewForDB(zapLogger *zap.Logger, dialector gorm.Dialector) Logger {
+	l := New(zapLogger)
+	if dsn, ok := dialectorDSN(dialector); ok {
+		l.Host, l.Port = parseDSNHost(dsn)
+	}
+	return l
+}
+
+// dialectorDSN returns the DSN field of dialector or of its embedded config.
+func dialectorDSN(dialector gorm.Dialector) (string, bool) {
+	v := reflect.ValueOf(dialector)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return "", false
+	}
+	field, ok := v.Type().FieldByName("DSN")
+	if !ok || field.Type.Kind() != reflect.String {
+		return "", false
+	}
+	for _, index := range field.Index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return "", false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(index)
+	}
+	return v.String(), true
+}
+
+// parseDSNHost returns the host and port of dsn, or their zero values when
+// they are not found. The formats are told apart from their structure rather
+// than from the characters they contain, which may appear in passwords.
+func parseDSNHost(dsn string) (host string, port int) {
+	dsn = strings.TrimSpace(dsn)
+	if isKeyValueDSN(dsn) {
+		return parseKeyValueDSNHost(dsn)
+	}
+	if addr, ok := mysqlDSNAddr(dsn); ok {
+		h, p, err := net.SplitHostPort(addr)
+		if err != nil {
+			return addr, 0
+		}
+		port, _ = strconv.Atoi(p)
+		return h, port
+	}
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", 0
+		}
+		port, _ = strconv.Atoi(u.Port())
+		return u.Hostname(), port
+	}
+	return "", 0
+}
+
+// isKeyValueDSN reports whether dsn starts like a Postgres key/value DSN,
+// with a key made of letters and underscores followed by =.
+func isKeyValueDSN(dsn string) bool {
+	for i := 0; i < len(dsn); i++ {
+		switch c := dsn[i]; {
+		case c == '=':
+			return i > 0
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// parseKeyValueDSNHost returns the host and port of a Postgres key/value
+// DSN, whose values may be single-quoted and contain backslash escapes.
+func parseKeyValueDSNHost(dsn string) (host string, port int) {
+	for i := 0; i < len(dsn); {
+		for i < len(dsn) && isSpaceByte(dsn[i]) {
+			i++
+		}
+		eq := strings.IndexByte(dsn[i:], '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(dsn[i : i+eq])
+		i += eq + 1
+		for i < len(dsn) && isSpaceByte(dsn[i]) {
+			i++
+		}
+		var value strings.Builder
+		quoted := i < len(dsn) && dsn[i] == '\''
+		if quoted {
+			i++
+		}
+		for ; i < len(dsn); i++ {
+			c := dsn[i]
+			if c == '\\' && i+1 < len(dsn) {
+				i++
+				value.WriteByte(dsn[i])
+				continue
+			}
+			if quoted && c == '\'' {
+				i++
+				break
+			}
+			if !quoted && isSpaceByte(c) {
+				break
+			}
+			value.WriteByte(c)
+		}
+		switch key {
+		case "host":
+			host = value.String()
+		case "port":
+			port, _ = strconv.Atoi(value.String())
+		}
+	}
+	return host, port
+}
+
+// mysqlDSNAddr returns the address of a MySQL DSN like
+// user:password@tcp(addr)/dbname?params: the one in the parentheses
+// following the last @ before the last /, as the password may contain any
+// character but the database name no /.
+func mysqlDSNAddr(dsn string) (string, bool) {
+	slash := strings.LastIndexByte(dsn, '/')
+	if slash < 0 {
+		return "", false
+	}
+	addr := dsn[strings.LastIndexByte(dsn[:slash], '@')+1 : slash]
+	open := strings.IndexByte(addr, '(')
+	if open <= 0 || !strings.HasSuffix(addr, ")") {
+		return "", false
+	}
+	for i := 0; i < open; i++ {
+		if !isIdentByte(addr[i]) {
+			return "", false
+		}
+	}
+	return addr[open+1 : len(addr)-1], true
+}
@@ -0,0 +1,43 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	gormlogger "gorm.io/gorm/logger"
+	"moul.io/zapgorm2"
+)
+
+// countingLogger embeds zapgorm2.Logger and overrides Trace. It also
+// overrides LogMode, which GORM calls for db.Debug() and sessions, so that the
+// returned logger keeps being a countingLogger.
+type countingLogger struct {
+	zapgorm2.Logger
+	traces *int
+}
+
+func (l countingLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	return countingLogger{Logger: l.Logger.LogMode(level).(zapgorm2.Logger), traces: l.traces}
+}
+
+func (l countingLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	*l.traces++
+	l.Logger.Trace(ctx, begin, fc, err)
+}
+
+func TestEmbedding(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	traces := 0
+	logger := countingLogger{Logger: zapgorm2.New(zap.New(core)), traces: &traces}
+	db := openDryRunDB(t, logger)
+
+	var users []testUser
+	db.Find(&users)
+	db.Debug().Find(&users)
+	require.Equal(t, 2, traces)
+	require.Equal(t, 1, logs.Len(), "only the Debug() query is logged")
+}
@@ -0,0 +1,42 @@
+package zapgorm2
+
+import (
+	"errors"
+)
+
+const defaultErrorSignatures = 1000
+
+// errorSignatures remembers the signatures of the errors already logged,
+// for ErrorLogOnce.
+type errorSignatures struct {
+	seen *seenSet
+}
+
+func newErrorSignatures(size int) *errorSignatures {
+	return &errorSignatures{seen: newSeenSet(size)}
+}
+
+// repeated records the signature of err and reports whether it was already
+// recorded.
+func (s *errorSignatures) repeated(err error) bool {
+	return s.seen.repeated(errorSignature(err))
+}
+
+// contains reports whether the signature of err was recorded, without
+// recording it.
+func (s *errorSignatures) contains(err error) bool {
+	return s.seen.contains(errorSignature(err))
+}
+
+// errorSignature identifies the kind of err: its SQLSTATE code when the
+// driver provides one, like pgconn.PgError, or else the Fingerprint of its
+// message, so that errors only differing by their values match.
+func errorSignature(err error) string {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		if code := state.SQLState(); code != "" {
+			return "sqlstate:" + code
+		}
+	}
+	return Fingerprint(err.Error())
+}
@@ -0,0 +1,57 @@
+package zapgorm2
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+// FieldMask is a set of the fields of Trace entries, so that only the
+// requested ones are built.
+type FieldMask uint32
+
+// The fields of FieldsDefault are logged unless their bit is cleared, and
+// the others when their bit is set or when their Log* option is.
+const (
+	// FieldError is the error field of failed queries.
+	FieldError FieldMask = 1 << iota
+	// FieldElapsed is the elapsed field.
+	FieldElapsed
+	// FieldRows is the rows field, subject to RowsMode and RowsFunc.
+	FieldRows
+	// FieldSQL is the sql or sql_hash field, see SQLMode.
+	FieldSQL
+	// FieldEvent is the gorm_event field, subject to EventField.
+	FieldEvent
+	// FieldCaller is the caller of the entries. Without it, the caller is
+	// not even looked up, and the Caller of TraceInfo is empty.
+	FieldCaller
+	// FieldQueryTime is the query_time field, like LogQueryTime.
+	FieldQueryTime
+	// FieldBeginTime is the begin field, like LogBeginTime.
+	FieldBeginTime
+	// FieldParamCount is the param_count field, like LogParamCount.
+	FieldParamCount
+	// FieldPlaceholderStyle is the placeholder_style field, like
+	// LogPlaceholderStyle.
+	FieldPlaceholderStyle
+	// FieldCallback is the callback field, like LogCallback.
+	FieldCallback
+)
+
+// FieldsDefault are the fields logged by default, when Fields is zero.
+const FieldsDefault = FieldError | FieldElapsed | FieldRows | FieldSQL | FieldEvent | FieldCaller
+
+// Has reports whether m contains all the fields of f, m being FieldsDefault
+// when zero.
+func (m FieldMask) Has(f FieldMask) bool {
+	if m == 0 {
+		m = FieldsDefault
+	}
+	return m&f == f
+}
+
+// ConditionalField is a rule of ConditionalFields: Field is added to the
+// Trace entries for which When returns true.
+type ConditionalField struct {
+	When  func(info TraceInfo) bool
+	Field func(info TraceInfo) zapcore.Field
+}
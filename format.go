@@ -0,0 +1,73 @@
+package zapgorm2
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// TraceMsgFn builds the message of a Trace entry from the traced query.
+type TraceMsgFn func(info TraceInfo) string
+
+// DefaultGormFormatMsgFns returns message callbacks reproducing the output
+// of GORM's default logger (without colors), to be assigned to QueryMsgFn,
+// SlowMsgFn and ErrorMsgFn:
+//
+//	logger.QueryMsgFn, logger.SlowMsgFn, logger.ErrorMsgFn = zapgorm2.DefaultGormFormatMsgFns()
+func DefaultGormFormatMsgFns() (query, slow, err TraceMsgFn) {
+	query = func(info TraceInfo) string {
+		return fmt.Sprintf("%s\n[%.3fms] [rows:%s] %s", info.Caller, elapsedMillis(info), gormRows(info.Rows), info.SQL)
+	}
+	slow = func(info TraceInfo) string {
+		slowLog := fmt.Sprintf("SLOW SQL >= %v", info.SlowThreshold)
+		return fmt.Sprintf("%s %s\n[%.3fms] [rows:%s] %s", info.Caller, slowLog, elapsedMillis(info), gormRows(info.Rows), info.SQL)
+	}
+	err = func(info TraceInfo) string {
+		return fmt.Sprintf("%s %s\n[%.3fms] [rows:%s] %s", info.Caller, info.Err, elapsedMillis(info), gormRows(info.Rows), info.SQL)
+	}
+	return query, slow, err
+}
+
+func elapsedMillis(info TraceInfo) float64 {
+	return float64(info.Elapsed.Nanoseconds()) / 1e6
+}
+
+// gormRows formats rows like GORM does, "-" standing for an unknown count.
+func gormRows(rows int64) string {
+	if rows == -1 {
+		return "-"
+	}
+	return strconv.FormatInt(rows, 10)
+}
+
+var gormQueryMsg, gormSlowMsg, gormErrorMsg = DefaultGormFormatMsgFns()
+
+// EncoderKind is the kind of encoder of the zap logger, for AutoStructured.
+type EncoderKind int
+
+const (
+	// EncoderKindUnknown disables AutoStructured.
+	EncoderKindUnknown EncoderKind = iota
+	// EncoderKindJSON is for zapcore.NewJSONEncoder, e.g. zap.NewProduction.
+	EncoderKindJSON
+	// EncoderKindConsole is for zapcore.NewConsoleEncoder, e.g.
+	// zap.NewDevelopment.
+	EncoderKindConsole
+)
+
+func (l Logger) encoderKind() EncoderKind {
+	if !l.AutoStructured {
+		return EncoderKindUnknown
+	}
+	return l.EncoderKind
+}
+
+func (l Logger) structuredMessages() bool {
+	switch l.encoderKind() {
+	case EncoderKindJSON:
+		return true
+	case EncoderKindConsole:
+		return false
+	default:
+		return l.StructuredMessages
+	}
+}
@@ -0,0 +1,118 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	gormlogger "gorm.io/gorm/logger"
+	"moul.io/zapgorm2"
+)
+
+type printfRecorder struct{ messages []string }
+
+func (r *printfRecorder) Printf(format string, args ...interface{}) {
+	r.messages = append(r.messages, fmt.Sprintf(format, args...))
+}
+
+// normalizeGormOutput masks the parts of a GORM message that legitimately
+// differ between two loggers: the caller prefix and the measured elapsed time.
+func normalizeGormOutput(msg string) string {
+	msg = regexp.MustCompile(`^\S*`).ReplaceAllString(msg, "<caller>")
+	return regexp.MustCompile(`\[\d+\.\d{3}ms\]`).ReplaceAllString(msg, "[<elapsed>]")
+}
+
+func TestDefaultGormFormatMsgFns(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.QueryMsgFn, logger.SlowMsgFn, logger.ErrorMsgFn = zapgorm2.DefaultGormFormatMsgFns()
+	recorder := &printfRecorder{}
+	gormLogger := gormlogger.New(recorder, gormlogger.Config{
+		SlowThreshold: logger.SlowThreshold,
+		LogLevel:      gormlogger.Info,
+	})
+
+	ctx := context.Background()
+	traces := []struct {
+		begin time.Time
+		rows  int64
+		err   error
+	}{
+		{time.Now(), 3, nil},
+		{time.Now(), -1, nil},
+		{time.Now().Add(-time.Second), 3, nil},
+		{time.Now(), 3, errors.New("boom")},
+	}
+	for _, trace := range traces {
+		trace := trace
+		fc := func() (string, int64) { return "SELECT * FROM `users`", trace.rows }
+		logger.Trace(ctx, trace.begin, fc, trace.err)
+		gormLogger.Trace(ctx, trace.begin, fc, trace.err)
+	}
+
+	require.Equal(t, len(traces), logs.Len())
+	require.Len(t, recorder.messages, len(traces))
+	for i, entry := range logs.All() {
+		require.Equal(t, normalizeGormOutput(recorder.messages[i]), normalizeGormOutput(entry.Message))
+		require.Empty(t, entry.Context)
+	}
+	require.Contains(t, logs.All()[1].Message, "[rows:-]")
+	require.Contains(t, logs.All()[2].Message, "SLOW SQL >= 100ms")
+}
+
+func TestAutoStructured(t *testing.T) {
+	tests := []struct {
+		kind       zapgorm2.EncoderKind
+		structured bool
+	}{
+		{zapgorm2.EncoderKindJSON, true},
+		{zapgorm2.EncoderKindConsole, false},
+	}
+	for _, tt := range tests {
+		core, logs := observer.New(zap.DebugLevel)
+		logger := zapgorm2.New(zap.New(core))
+		logger.AutoStructured = true
+		logger.EncoderKind = tt.kind
+		ctx := context.Background()
+
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+		logger.Warn(ctx, "deprecated %s", "feature")
+		require.Equal(t, 2, logs.Len())
+		trace, warn := logs.All()[0], logs.All()[1]
+		if tt.structured {
+			require.Equal(t, "trace", trace.Message)
+			require.Equal(t, "SELECT 1", trace.ContextMap()["sql"])
+			require.Equal(t, "warn", warn.Message)
+			require.Equal(t, "deprecated %s", warn.ContextMap()["gorm_msg"])
+			continue
+		}
+		require.Regexp(t, `boom\n\[\d+\.\d{3}ms\] \[rows:1\] SELECT 1$`, trace.Message)
+		require.Empty(t, trace.Context)
+		require.Equal(t, "deprecated feature", warn.Message)
+	}
+}
+
+func TestHybridMode(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.QueryMsgFn, logger.SlowMsgFn, logger.ErrorMsgFn = zapgorm2.DefaultGormFormatMsgFns()
+	logger.HybridMode = true
+	fc := func() (string, int64) { return "SELECT * FROM `users`", 3 }
+
+	logger.Trace(context.Background(), time.Now(), fc, nil)
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	require.Regexp(t, `\[rows:3\] SELECT \* FROM `+"`users`$", entry.Message)
+	fields := entry.ContextMap()
+	require.Equal(t, "SELECT * FROM `users`", fields["sql"])
+	require.Equal(t, int64(3), fields["rows"])
+	require.Contains(t, fields, "elapsed")
+}
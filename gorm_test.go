@@ -0,0 +1,183 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+	"moul.io/zapgorm2"
+)
+
+// dryRunDialector is a minimal gorm.Dialector building MySQL-like SQL, to be
+// used with gorm.Config.DryRun so that statements are traced without a
+// database.
+type dryRunDialector struct{}
+
+func (dryRunDialector) Name() string { return "dryrun" }
+
+func (dryRunDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	return nil
+}
+
+func (dryRunDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return migrator.Migrator{Config: migrator.Config{DB: db}}
+}
+
+func (dryRunDialector) DataTypeOf(*schema.Field) string { return "" }
+
+func (dryRunDialector) DefaultValueOf(*schema.Field) clause.Expression { return nil }
+
+func (dryRunDialector) BindVarTo(writer clause.Writer, stmt *gorm.Statement, v interface{}) {
+	_ = writer.WriteByte('?')
+}
+
+func (dryRunDialector) QuoteTo(writer clause.Writer, str string) {
+	_ = writer.WriteByte('`')
+	_, _ = writer.WriteString(str)
+	_ = writer.WriteByte('`')
+}
+
+func (dryRunDialector) Explain(sql string, vars ...interface{}) string {
+	return gormlogger.ExplainSQL(sql, nil, `'`, vars...)
+}
+
+type testUser struct {
+	ID    uint
+	Name  string
+	Email string
+}
+
+func openDryRunDB(t *testing.T, logger gormlogger.Interface) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(dryRunDialector{}, &gorm.Config{Logger: logger, DryRun: true})
+	require.NoError(t, err)
+	require.NoError(t, zapgorm2.RegisterCallbacks(db))
+	return db
+}
+
+// failQueries makes every subsequent query run on db fail.
+func failQueries(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:fail", func(db *gorm.DB) {
+		_ = db.AddError(errors.New("query failed"))
+	}))
+}
+
+func TestRegisterCallbacksIsIdempotent(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	db := openDryRunDB(t, zapgorm2.New(zaplogger))
+	require.NoError(t, zapgorm2.RegisterCallbacks(db))
+	require.Equal(t, 0, logs.Len(), "duplicated callbacks are reported as warnings")
+}
+
+func TestAttachTo(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogSQLArgs = true
+	db, err := gorm.Open(dryRunDialector{}, &gorm.Config{DryRun: true})
+	require.NoError(t, err)
+
+	require.NoError(t, logger.LogMode(gormlogger.Info).(zapgorm2.Logger).AttachTo(db))
+	require.NoError(t, logger.LogMode(gormlogger.Info).(zapgorm2.Logger).AttachTo(db))
+	require.Equal(t, 0, logs.Len(), "duplicated callbacks are reported as warnings")
+
+	db.Where("name = ?", "jinzhu").Find(&[]testUser{})
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, `["jinzhu"]`, logs.All()[0].ContextMap()["args"])
+}
+
+func TestLogCallback(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogCallback = true
+	db := openDryRunDB(t, logger)
+
+	db.Create(&testUser{Name: "alice"})
+	db.Find(&[]testUser{})
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "create", logs.All()[0].ContextMap()["callback"])
+	require.Equal(t, "query", logs.All()[1].ContextMap()["callback"])
+}
+
+func TestLogModel(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogModel = true
+	db := openDryRunDB(t, logger)
+
+	db.Find(&[]testUser{})
+	db.Exec("DELETE FROM sessions")
+	db.WithContext(zapgorm2.ContextWithModel(context.Background(), "Session")).Exec("DELETE FROM sessions")
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, "testUser", logs.All()[0].ContextMap()["model"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "model")
+	require.Equal(t, "Session", logs.All()[2].ContextMap()["model"])
+}
+
+// fakeTx is a gorm.ConnPool of a transaction, for DryRun sessions.
+type fakeTx struct {
+	gorm.ConnPool
+}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func TestLogInTransactionGORM(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogInTransaction = true
+	db := openDryRunDB(t, logger)
+
+	db.Find(&[]testUser{})
+	tx := db.Session(&gorm.Session{})
+	tx.Statement.ConnPool = fakeTx{}
+	tx.Find(&[]testUser{})
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, false, logs.All()[0].ContextMap()["in_transaction"])
+	require.Equal(t, true, logs.All()[1].ContextMap()["in_transaction"])
+}
+
+func TestPostErrorVerboseCount(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.PostErrorVerboseCount = 2
+	db := openDryRunDB(t, logger)
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:fail-bob", func(db *gorm.DB) {
+		if db.Statement.Vars[0] == "bob" {
+			_ = db.AddError(errors.New("query failed"))
+		}
+	}))
+	var users []testUser
+	find := func(ctx context.Context, name string) {
+		db.WithContext(ctx).Where("name = ?", name).Find(&users)
+	}
+
+	ctx := zapgorm2.ContextForRequest(context.Background())
+	find(ctx, "alice")
+	find(ctx, "bob")
+	find(ctx, "carol")
+	find(context.Background(), "dave")
+	find(ctx, "erin")
+	find(ctx, "frank")
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, zap.ErrorLevel, logs.All()[0].Level)
+	for _, entry := range logs.All()[1:] {
+		require.Equal(t, zap.InfoLevel, entry.Level)
+		require.Equal(t, true, entry.ContextMap()["post_error"])
+	}
+	require.Equal(t, `["carol"]`, logs.All()[1].ContextMap()["args"])
+	require.Equal(t, `["erin"]`, logs.All()[2].ContextMap()["args"])
+}
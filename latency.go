@@ -0,0 +1,124 @@
+package zapgorm2
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLatencyReservoirSize = 1024
+	defaultLatencyInterval      = time.Minute
+)
+
+// WithLatencySummary returns a copy of the logger that samples the elapsed
+// time of every traced query and logs a p50/p95/p99 summary every interval,
+// or every minute when interval is not positive, which Validate reports.
+//
+// Samples are kept in a reservoir of at most size entries (1024 when size is
+// not positive), so memory stays bounded regardless of traffic. Once more
+// queries than size are traced within an interval, the reported percentiles
+// are computed from a uniform random sample and are therefore approximate.
+//
+// The background goroutine is stopped by Close.
+func (l Logger) WithLatencySummary(interval time.Duration, size int) Logger {
+	if size <= 0 {
+		size = defaultLatencyReservoirSize
+	}
+	s := &latencySummary{
+		samples:         make([]time.Duration, 0, size),
+		size:            size,
+		rand:            rand.New(rand.NewSource(time.Now().UnixNano())),
+		invalidInterval: interval <= 0,
+		done:            make(chan struct{}),
+	}
+	if interval <= 0 {
+		interval = defaultLatencyInterval
+	}
+	go s.run(l.ZapLogger, interval)
+	l.latency = s
+	return l
+}
+
+type latencySummary struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	seen    int64
+	size    int
+	rand    *rand.Rand
+
+	invalidInterval bool // reported by Validate
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// add records d using reservoir sampling (algorithm R).
+func (s *latencySummary) add(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen++
+	if len(s.samples) < s.size {
+		s.samples = append(s.samples, d)
+		return
+	}
+	if j := s.rand.Int63n(s.seen); j < int64(s.size) {
+		s.samples[j] = d
+	}
+}
+
+// reset empties the reservoir and returns its sorted content and the number
+// of queries seen since the previous reset.
+func (s *latencySummary) reset() ([]time.Duration, int64) {
+	s.mu.Lock()
+	samples := make([]time.Duration, len(s.samples))
+	copy(samples, s.samples)
+	seen := s.seen
+	s.samples = s.samples[:0]
+	s.seen = 0
+	s.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples, seen
+}
+
+func (s *latencySummary) run(logger *zap.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			samples, seen := s.reset()
+			if seen == 0 {
+				continue
+			}
+			logger.Info("latency summary",
+				zap.Int64("count", seen),
+				zap.Duration("p50", percentile(samples, 50)),
+				zap.Duration("p95", percentile(samples, 95)),
+				zap.Duration("p99", percentile(samples, 99)),
+			)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *latencySummary) stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+}
+
+// percentile returns the nearest-rank percentile p of the sorted samples.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,39 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"moul.io/zapgorm2"
+)
+
+func TestLatencySummary(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zapgorm2.New(zap.New(core)).WithLatencySummary(10*time.Millisecond, 16)
+	defer logger.Close()
+
+	begin := time.Now().Add(-50 * time.Millisecond)
+	for i := 0; i < 100; i++ {
+		logger.Trace(context.Background(), begin, func() (string, int64) { return "SELECT 1", 1 }, nil)
+	}
+
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("latency summary").Len() > 0
+	}, time.Second, 5*time.Millisecond)
+	fields := logs.FilterMessage("latency summary").All()[0].ContextMap()
+	require.Equal(t, int64(100), fields["count"])
+	require.GreaterOrEqual(t, fields["p50"].(time.Duration), 50*time.Millisecond)
+	require.GreaterOrEqual(t, fields["p99"].(time.Duration), fields["p50"].(time.Duration))
+}
+
+func TestLatencySummaryNonPositiveInterval(t *testing.T) {
+	// A ticker panic in the background goroutine would crash the test binary.
+	logger := zapgorm2.New(zap.NewNop()).WithLatencySummary(0, 0)
+	logger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 1", 1 }, nil)
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, logger.Close())
+}
@@ -0,0 +1,65 @@
+package zapgorm2
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// GormLevel maps a zap level to the closest GORM log level:
+//
+//	zap level                  GORM level
+//	DebugLevel, InfoLevel      Info
+//	WarnLevel                  Warn
+//	ErrorLevel, DPanicLevel,
+//	PanicLevel, FatalLevel     Error
+//	above FatalLevel           Silent
+//
+// GORM's Info level is logged at zap's DebugLevel, so mapping a zap level
+// and logging back at it keeps every entry the zap level lets through.
+func GormLevel(level zapcore.Level) gormlogger.LogLevel {
+	switch {
+	case level <= zapcore.InfoLevel:
+		return gormlogger.Info
+	case level == zapcore.WarnLevel:
+		return gormlogger.Warn
+	case level <= zapcore.FatalLevel:
+		return gormlogger.Error
+	default:
+		return gormlogger.Silent
+	}
+}
+
+// LogModeZap is like LogMode, with the level given as a zap level and
+// mapped with GormLevel.
+func (l Logger) LogModeZap(level zapcore.Level) Logger {
+	return l.LogMode(GormLevel(level)).(Logger)
+}
+
+// cloudLoggingSeverities are the names of the zap levels in the severity
+// field of Google Cloud Logging.
+var cloudLoggingSeverities = map[zapcore.Level]string{
+	zapcore.DebugLevel:  "DEBUG",
+	zapcore.InfoLevel:   "INFO",
+	zapcore.WarnLevel:   "WARNING",
+	zapcore.ErrorLevel:  "ERROR",
+	zapcore.DPanicLevel: "CRITICAL",
+	zapcore.PanicLevel:  "ALERT",
+	zapcore.FatalLevel:  "EMERGENCY",
+}
+
+func (l Logger) severityField(level zapcore.Level) zapcore.Field {
+	key := l.SeverityKey
+	if key == "" {
+		key = "severity"
+	}
+	names := l.SeverityNames
+	if names == nil {
+		names = cloudLoggingSeverities
+	}
+	name, ok := names[level]
+	if !ok {
+		name = level.CapitalString()
+	}
+	return zap.String(key, name)
+}
@@ -0,0 +1,71 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	gormlogger "gorm.io/gorm/logger"
+	"moul.io/zapgorm2"
+)
+
+func TestGormLevel(t *testing.T) {
+	tests := []struct {
+		zap  zapcore.Level
+		gorm gormlogger.LogLevel
+	}{
+		{zapcore.DebugLevel, gormlogger.Info},
+		{zapcore.InfoLevel, gormlogger.Info},
+		{zapcore.WarnLevel, gormlogger.Warn},
+		{zapcore.ErrorLevel, gormlogger.Error},
+		{zapcore.DPanicLevel, gormlogger.Error},
+		{zapcore.PanicLevel, gormlogger.Error},
+		{zapcore.FatalLevel, gormlogger.Error},
+		{zapcore.FatalLevel + 1, gormlogger.Silent},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.gorm, zapgorm2.GormLevel(tt.zap), tt.zap.String())
+	}
+}
+
+func TestLogModeZap(t *testing.T) {
+	logger := zapgorm2.New(zap.NewNop())
+	require.Equal(t, gormlogger.Info, logger.LogModeZap(zapcore.DebugLevel).LogLevel)
+	require.Equal(t, gormlogger.Error, logger.LogModeZap(zapcore.ErrorLevel).LogLevel)
+	require.Equal(t, gormlogger.Warn, logger.LogLevel)
+}
+
+func TestSeverityField(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.SeverityField = true
+	logger.OperationLevels = map[string]zapcore.Level{"INSERT": zapcore.InfoLevel}
+	ctx := context.Background()
+	trace := func(begin time.Time, sql string, err error) {
+		logger.Trace(ctx, begin, func() (string, int64) { return sql, 1 }, err)
+	}
+
+	trace(time.Now(), "SELECT 1", nil)
+	trace(time.Now(), "INSERT INTO users (name) VALUES ('alice')", nil)
+	trace(time.Now().Add(-time.Second), "SELECT 1", nil)
+	trace(time.Now(), "SELECT 1", errors.New("boom"))
+	logger.Warn(ctx, "warning")
+	logger.SeverityKey = "level_name"
+	logger.SeverityNames = map[zapcore.Level]string{zapcore.ErrorLevel: "E"}
+	logger.Error(ctx, "failure")
+	logger.Warn(ctx, "warning")
+
+	var severities []interface{}
+	for _, entry := range logs.All() {
+		severities = append(severities, entry.ContextMap()["severity"])
+	}
+	require.Equal(t, []interface{}{"DEBUG", "INFO", "WARNING", "ERROR", "WARNING", nil, nil}, severities)
+	require.Equal(t, "E", logs.All()[5].ContextMap()["level_name"])
+	require.Equal(t, "WARN", logs.All()[6].ContextMap()["level_name"])
+}
@@ -0,0 +1,87 @@
+package zapgorm2
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru is a fixed-size least recently used cache. It is not safe for
+// concurrent use.
+type lru struct {
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the value of key and marks it as recently used.
+func (c *lru) get(key string) (interface{}, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*lruEntry).value, true
+}
+
+// add sets the value of key, evicting the least recently used key when the
+// cache is full.
+func (c *lru) add(key string, value interface{}) {
+	if elem, ok := c.items[key]; ok {
+		c.ll.MoveToFront(elem)
+		elem.Value.(*lruEntry).value = value
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value})
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lru) len() int {
+	return c.ll.Len()
+}
+
+// seenSet is a set of at most size keys, the least recently seen ones being
+// evicted. It is safe for concurrent use.
+type seenSet struct {
+	mu   sync.Mutex
+	seen *lru
+}
+
+func newSeenSet(size int) *seenSet {
+	return &seenSet{seen: newLRU(size)}
+}
+
+// repeated records key and reports whether it was already recorded.
+func (s *seenSet) repeated(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen.get(key); ok {
+		return true
+	}
+	s.seen.add(key, nil)
+	return false
+}
+
+// contains reports whether key was recorded, without recording it.
+func (s *seenSet) contains(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.seen.items[key]
+	return ok
+}
@@ -0,0 +1,198 @@
+package zapgorm2
+
+import (
+	"strings"
+)
+
+const maskedValue = "***"
+
+// maskSQL replaces with *** the literal values compared to columns in sql.
+func maskSQL(sql string, columns []string) string {
+	spans := maskedValues(sql, columns)
+	if len(spans) == 0 {
+		return sql
+	}
+	var b strings.Builder
+	b.Grow(len(sql))
+	prev := 0
+	for _, span := range spans {
+		if sql[span[0]] == '?' || sql[span[0]] == '$' {
+			continue
+		}
+		b.WriteString(sql[prev:span[0]])
+		b.WriteString(maskedValue)
+		prev = span[1]
+	}
+	b.WriteString(sql[prev:])
+	return b.String()
+}
+
+// maskArgs returns a copy of the bound variables of the statement sql, in
+// which the ones compared to columns are replaced with ***.
+func maskArgs(sql string, args []interface{}, columns []string) []interface{} {
+	spans := maskedValues(sql, columns)
+	if len(spans) == 0 {
+		return args
+	}
+	masked := make([]interface{}, len(args))
+	copy(masked, args)
+	ordinal := 0
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = quotedEnd(sql, i)
+			continue
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			i = commentEnd(sql, i)
+			continue
+		case c == '?':
+			if inSpans(spans, i) && ordinal < len(masked) {
+				masked[ordinal] = maskedValue
+			}
+			ordinal++
+		case c == '$' && i+1 < len(sql) && isDigitByte(sql[i+1]):
+			end, n := i+1, 0
+			for ; end < len(sql) && isDigitByte(sql[end]); end++ {
+				n = n*10 + int(sql[end]-'0')
+			}
+			if inSpans(spans, i) && n >= 1 && n <= len(masked) {
+				masked[n-1] = maskedValue
+			}
+			i = end
+			continue
+		}
+		i++
+	}
+	return masked
+}
+
+func inSpans(spans [][2]int, i int) bool {
+	for _, span := range spans {
+		if i >= span[0] && i < span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// maskedValues returns the byte ranges of the values, literals or
+// placeholders, compared to one of columns in sql with col = value or
+// col [NOT] IN (value, ...). Columns match case-insensitively, with or
+// without a table qualifier.
+func maskedValues(sql string, columns []string) [][2]int {
+	var (
+		spans  [][2]int
+		column string
+	)
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case isSpaceByte(c), c == '.':
+			i++
+			continue
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			i = commentEnd(sql, i)
+			continue
+		case c == '"' || c == '`':
+			end := quotedEnd(sql, i)
+			column = strings.Trim(sql[i:end], string(c))
+			i = end
+			continue
+		case isIdentByte(c) && !isDigitByte(c):
+			end := i
+			for end < len(sql) && isIdentByte(sql[end]) {
+				end++
+			}
+			word := sql[i:end]
+			i = end
+			switch {
+			case isMaskedColumn(column, columns) && strings.EqualFold(word, "NOT"):
+			case isMaskedColumn(column, columns) && strings.EqualFold(word, "IN"):
+				i, spans = maskedList(sql, i, spans)
+				column = ""
+			default:
+				column = word
+			}
+			continue
+		case c == '=' && isMaskedColumn(column, columns) && !strings.HasPrefix(sql[i:], "=="):
+			start := skipSpaceAndComments(sql, i+1)
+			if end := valueEnd(sql, start); end > start {
+				spans = append(spans, [2]int{start, end})
+				i = end
+			} else {
+				i = start
+			}
+			column = ""
+			continue
+		case c == '\'':
+			i = quotedEnd(sql, i)
+		default:
+			i++
+		}
+		column = ""
+	}
+	return spans
+}
+
+// maskedList appends to spans the values of the parenthesized list starting
+// at sql[i:], if any, and returns the index following it.
+func maskedList(sql string, i int, spans [][2]int) (int, [][2]int) {
+	i = skipSpaceAndComments(sql, i)
+	if i >= len(sql) || sql[i] != '(' {
+		return i, spans
+	}
+	for i++; i < len(sql); {
+		i = skipSpaceAndComments(sql, i)
+		end := valueEnd(sql, i)
+		if end == i {
+			return i, spans
+		}
+		spans = append(spans, [2]int{i, end})
+		i = skipSpaceAndComments(sql, end)
+		if i >= len(sql) || sql[i] != ',' {
+			return i, spans
+		}
+		i++
+	}
+	return i, spans
+}
+
+// valueEnd returns the end of the string or numeric literal or placeholder
+// starting at sql[i:], or i if there is none.
+func valueEnd(sql string, i int) int {
+	if i >= len(sql) {
+		return i
+	}
+	switch c := sql[i]; {
+	case c == '\'':
+		return quotedEnd(sql, i)
+	case c == '?':
+		return i + 1
+	case c == '$' && i+1 < len(sql) && isDigitByte(sql[i+1]):
+		end := i + 1
+		for end < len(sql) && isDigitByte(sql[end]) {
+			end++
+		}
+		return end
+	case isDigitByte(c) || c == '-' && i+1 < len(sql) && isDigitByte(sql[i+1]):
+		end := i + 1
+		for end < len(sql) && (isDigitByte(sql[end]) || sql[end] == '.') {
+			end++
+		}
+		return end
+	}
+	return i
+}
+
+func isMaskedColumn(column string, columns []string) bool {
+	if column == "" {
+		return false
+	}
+	for _, c := range columns {
+		if strings.EqualFold(column, c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package zapgorm2
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// poolErrorMessages are the messages of the common pool exhaustion errors
+// of databases and drivers.
+var poolErrorMessages = []string{
+	"too many connections",
+	"too many clients",
+	"remaining connection slots are reserved",
+	"connection pool exhausted",
+	"connection pool timeout",
+}
+
+// DefaultIsPoolError is an IsPoolError matching the messages of the common
+// pool exhaustion errors of MySQL, Postgres and their drivers, like "Error
+// 1040: Too many connections" or "sorry, too many clients already".
+func DefaultIsPoolError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, m := range poolErrorMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// poolExhaustedDue reports whether OnPoolExhausted is to be called, at most
+// once per PoolExhaustedInterval within the loggers sharing poolFired.
+func (l Logger) poolExhaustedDue() bool {
+	if l.PoolExhaustedInterval <= 0 || l.poolFired == nil {
+		return true
+	}
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(l.poolFired)
+	if last != 0 && now-last < int64(l.PoolExhaustedInterval) {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(l.poolFired, last, now)
+}
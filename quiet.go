@@ -0,0 +1,45 @@
+package zapgorm2
+
+import (
+	"time"
+)
+
+// TimeOfDayRange is a range of times of day, from Start included to End
+// excluded, given as offsets since midnight in [0, 24h). It wraps around
+// midnight when End is before Start, e.g. {22 * time.Hour, 6 * time.Hour}.
+type TimeOfDayRange struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Contains reports whether the time of day of t, in its location, is in r.
+func (r TimeOfDayRange) Contains(t time.Time) bool {
+	hour, min, sec := t.Clock()
+	d := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute +
+		time.Duration(sec)*time.Second + time.Duration(t.Nanosecond())
+	if r.Start <= r.End {
+		return r.Start <= d && d < r.End
+	}
+	return d >= r.Start || d < r.End
+}
+
+func validTimeOfDayRanges(ranges []TimeOfDayRange) bool {
+	for _, r := range ranges {
+		if r.Start < 0 || r.Start >= 24*time.Hour || r.End < 0 || r.End >= 24*time.Hour {
+			return false
+		}
+	}
+	return true
+}
+
+// inSlowQuietHours reports whether begin, in TimeZone, is in one of the
+// SlowQuietHours.
+func (l Logger) inSlowQuietHours(begin time.Time) bool {
+	begin = l.inTimeZone(begin)
+	for _, r := range l.SlowQuietHours {
+		if r.Contains(begin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package zapgorm2
+
+import (
+	"sync"
+	"time"
+)
+
+// RecentQuery is a query kept by KeepRecent.
+type RecentQuery struct {
+	Begin       time.Time
+	Fingerprint string
+	Elapsed     time.Duration
+	Err         error
+}
+
+// recentQueries is a ring buffer of the last traced queries.
+type recentQueries struct {
+	mu      sync.Mutex
+	queries []RecentQuery
+	next    int
+	full    bool
+}
+
+func (r *recentQueries) add(size int, q RecentQuery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.queries) != size {
+		kept := r.snapshot(size)
+		r.queries = make([]RecentQuery, size)
+		r.next = copy(r.queries, kept) % size
+		r.full = len(kept) == size
+	}
+	r.queries[r.next] = q
+	r.next = (r.next + 1) % size
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns a copy of the last n queries, oldest first. It must be
+// called with mu held.
+func (r *recentQueries) snapshot(n int) []RecentQuery {
+	size := r.next
+	if r.full {
+		size = len(r.queries)
+	}
+	if n <= 0 || n > size {
+		n = size
+	}
+	out := make([]RecentQuery, 0, n)
+	for i := size - n; i < size; i++ {
+		idx := i
+		if r.full {
+			idx = (r.next + i) % len(r.queries)
+		}
+		out = append(out, r.queries[idx])
+	}
+	return out
+}
+
+// RecentQueries returns a copy of the last n queries traced by the logger
+// and the loggers derived from it, oldest first, or all the kept ones when
+// n is not positive. Queries are only kept with KeepRecent.
+func (l Logger) RecentQueries(n int) []RecentQuery {
+	if l.recent == nil {
+		return nil
+	}
+	l.recent.mu.Lock()
+	defer l.recent.mu.Unlock()
+	return l.recent.snapshot(n)
+}
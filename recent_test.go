@@ -0,0 +1,59 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	gormlogger "gorm.io/gorm/logger"
+	"moul.io/zapgorm2"
+)
+
+func TestKeepRecent(t *testing.T) {
+	logger := zapgorm2.New(zap.NewNop()).LogMode(gormlogger.Silent).(zapgorm2.Logger)
+	require.Empty(t, logger.RecentQueries(0))
+	logger.KeepRecent = 3
+	ctx := context.Background()
+
+	for i := 1; i <= 5; i++ {
+		sql := "SELECT " + strconv.Itoa(i) + " FROM t" + strconv.Itoa(i)
+		var err error
+		if i == 5 {
+			err = errors.New("boom")
+		}
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return sql, 1 }, err)
+	}
+	recent := logger.RecentQueries(0)
+	require.Len(t, recent, 3)
+	require.Equal(t, "SELECT ? FROM t3", recent[0].Fingerprint)
+	require.Equal(t, "SELECT ? FROM t4", recent[1].Fingerprint)
+	require.Equal(t, "SELECT ? FROM t5", recent[2].Fingerprint)
+	require.EqualError(t, recent[2].Err, "boom")
+	require.Equal(t, recent[1:], logger.RecentQueries(2))
+
+	recent[0].Fingerprint = "modified"
+	require.Equal(t, "SELECT ? FROM t3", logger.RecentQueries(0)[0].Fingerprint, "RecentQueries returns a copy")
+}
+
+func TestKeepRecentConcurrency(t *testing.T) {
+	logger := zapgorm2.New(zap.NewNop())
+	logger.KeepRecent = 10
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 1", 1 }, nil)
+				logger.RecentQueries(5)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, logger.RecentQueries(0), 10)
+}
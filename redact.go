@@ -0,0 +1,34 @@
+package zapgorm2
+
+import (
+	"regexp"
+)
+
+// Redactor removes sensitive values from the SQL of Trace entries, with
+// RedactSQL. It may be backed by a SQL parser to know where the values are.
+type Redactor interface {
+	Redact(sql string) string
+}
+
+// RegexRedactor is a Redactor replacing the matches of Patterns with
+// Replacement. It does not know the SQL grammar, so a pattern may match in
+// identifiers or comments as well.
+type RegexRedactor struct {
+	Patterns    []*regexp.Regexp
+	Replacement string
+}
+
+// Redact implements Redactor.
+func (r RegexRedactor) Redact(sql string) string {
+	for _, pattern := range r.Patterns {
+		sql = pattern.ReplaceAllLiteralString(sql, r.Replacement)
+	}
+	return sql
+}
+
+// DefaultRedactor is the Redactor of RedactSQL when Redactor is nil: it
+// replaces the quoted strings and the numbers with ?.
+var DefaultRedactor Redactor = RegexRedactor{
+	Patterns:    []*regexp.Regexp{regexp.MustCompile(`'(?:[^']|'')*'|\b\d+(?:\.\d+)?\b`)},
+	Replacement: "?",
+}
@@ -0,0 +1,56 @@
+package zapgorm2
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const maxRoutedLoggers = 64
+
+// routedLoggers caches the loggers writing to the cores returned by CoreFor,
+// so that loggers are not rebuilt for every entry.
+type routedLoggers struct {
+	mu      sync.Mutex
+	loggers map[routedLoggerKey]*zap.Logger
+}
+
+type routedLoggerKey struct {
+	base *zap.Logger
+	core zapcore.Core
+}
+
+// routedLogger returns the logger of the entries of ctx at level: the zap
+// logger, or a copy of it writing to the core returned by CoreFor.
+func (l Logger) routedLogger(ctx context.Context, level zapcore.Level) *zap.Logger {
+	if l.CoreFor == nil {
+		return l.ZapLogger
+	}
+	core := l.CoreFor(ctx, level)
+	if core == nil {
+		return l.ZapLogger
+	}
+	newLogger := func() *zap.Logger {
+		return l.ZapLogger.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core { return core }))
+	}
+	// Only pointer cores are cached: a comparable struct may hold a core
+	// that is not, e.g. the core of zapcore.NewTee.
+	if l.routed == nil || reflect.TypeOf(core).Kind() != reflect.Ptr {
+		return newLogger()
+	}
+	key := routedLoggerKey{base: l.ZapLogger, core: core}
+	l.routed.mu.Lock()
+	defer l.routed.mu.Unlock()
+	if logger, ok := l.routed.loggers[key]; ok {
+		return logger
+	}
+	if l.routed.loggers == nil || len(l.routed.loggers) >= maxRoutedLoggers {
+		l.routed.loggers = make(map[routedLoggerKey]*zap.Logger)
+	}
+	logger := newLogger()
+	l.routed.loggers[key] = logger
+	return logger
+}
@@ -0,0 +1,68 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	gormlogger "gorm.io/gorm/logger"
+	"moul.io/zapgorm2"
+)
+
+func TestCoreFor(t *testing.T) {
+	type tenantKey struct{}
+	defaultCore, defaultLogs := observer.New(zap.DebugLevel)
+	acmeCore, acmeLogs := observer.New(zap.DebugLevel)
+	globexCore, globexLogs := observer.New(zap.WarnLevel)
+	cores := map[string]zapcore.Core{"acme": acmeCore, "globex": globexCore}
+	logger := zapgorm2.New(zap.New(defaultCore))
+	calls := 0
+	logger.CoreFor = func(ctx context.Context, level zapcore.Level) zapcore.Core {
+		calls++
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return cores[tenant]
+	}
+	acme := context.WithValue(context.Background(), tenantKey{}, "acme")
+	globex := context.WithValue(context.Background(), tenantKey{}, "globex")
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(acme, time.Now(), fc, errors.New("boom"))
+	logger.Trace(acme, time.Now(), fc, errors.New("boom"))
+	logger.Warn(globex, "warning")
+	logger.Trace(globex, time.Now(), fc, errors.New("boom"))
+	logger.Error(context.Background(), "failure")
+	require.Equal(t, 5, calls)
+	require.Equal(t, 2, acmeLogs.Len())
+	require.Equal(t, "boom", acmeLogs.All()[0].ContextMap()["error"])
+	require.Equal(t, 2, globexLogs.Len())
+	require.Equal(t, "warning", globexLogs.All()[0].Message)
+	require.Equal(t, 1, defaultLogs.Len())
+	require.Equal(t, "failure", defaultLogs.All()[0].Message)
+
+	logger.LogLevel = gormlogger.Info
+	logger.Info(globex, "filtered by the level of the routed core")
+	require.Equal(t, 2, globexLogs.Len())
+}
+
+// wrappedCore is a comparable core holding a core that is not.
+type wrappedCore struct{ zapcore.Core }
+
+func TestCoreForTee(t *testing.T) {
+	a, aLogs := observer.New(zap.DebugLevel)
+	b, bLogs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.NewNop())
+	logger.CoreFor = func(context.Context, zapcore.Level) zapcore.Core {
+		return wrappedCore{zapcore.NewTee(a, b)}
+	}
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, aLogs.Len())
+	require.Equal(t, 2, bLogs.Len())
+}
@@ -0,0 +1,491 @@
+package zapgorm2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// sqlVerb returns the upper-cased leading keyword of sql (SELECT, INSERT,
+// CREATE, ...), skipping leading whitespace, comments and parentheses.
+func sqlVerb(sql string) string {
+	i := skipSpaceAndComments(sql, 0)
+	for i < len(sql) && sql[i] == '(' {
+		i = skipSpaceAndComments(sql, i+1)
+	}
+	start := i
+	for i < len(sql) && isIdentByte(sql[i]) {
+		i++
+	}
+	return strings.ToUpper(sql[start:i])
+}
+
+// skipSpaceAndComments returns the index of the first byte at or after i that
+// is neither whitespace nor part of a comment.
+func skipSpaceAndComments(sql string, i int) int {
+	for i < len(sql) {
+		switch {
+		case isSpaceByte(sql[i]):
+			i++
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			i = commentEnd(sql, i)
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isDDL(sql string) bool {
+	switch sqlVerb(sql) {
+	case "CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME":
+		return true
+	}
+	return false
+}
+
+// compactSQL collapses runs of whitespace outside of quoted strings and
+// identifiers into a single space and trims leading and trailing whitespace.
+func compactSQL(sql string) string {
+	if !needsCompaction(sql) {
+		return sql
+	}
+	var b strings.Builder
+	b.Grow(len(sql))
+	var quote byte
+	space := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case isSpaceByte(c):
+			space = true
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// stripSQLComments removes the comments of sql outside of quoted strings
+// and identifiers, keeping the tokens around them apart.
+func stripSQLComments(sql string) string {
+	if !strings.Contains(sql, "--") && !strings.Contains(sql, "/*") {
+		return sql
+	}
+	var b strings.Builder
+	b.Grow(len(sql))
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(sql, i)
+			b.WriteString(sql[i:end])
+			i = end
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			i = commentEnd(sql, i)
+			for i < len(sql) && isSpaceByte(sql[i]) {
+				i++
+			}
+			if s := b.String(); s != "" && !isSpaceByte(s[len(s)-1]) && i < len(sql) {
+				b.WriteByte(' ')
+			}
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return strings.TrimRight(b.String(), " \t\n\r\f\v")
+}
+
+// needsCompaction reports whether compactSQL would change sql, so that the
+// common already-compact case does not allocate.
+func needsCompaction(sql string) bool {
+	if sql == "" {
+		return false
+	}
+	if isSpaceByte(sql[0]) || isSpaceByte(sql[len(sql)-1]) {
+		return true
+	}
+	for i := 0; i < len(sql); i++ {
+		if c := sql[i]; isSpaceByte(c) && (c != ' ' || isSpaceByte(sql[i+1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint normalizes sql so that statements with the same shape share
+// the same fingerprint: string and numeric literals and $n placeholders are
+// replaced by ?, and whitespace is collapsed. Quoted identifiers, keyword
+// casing and comments are kept as is.
+func Fingerprint(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	space := false
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		if isSpaceByte(c) {
+			space = true
+			i++
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+
+		switch {
+		case c == '\'':
+			i = quotedEnd(sql, i)
+			b.WriteByte('?')
+		case c == '"' || c == '`':
+			end := quotedEnd(sql, i)
+			b.WriteString(sql[i:end])
+			i = end
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			end := commentEnd(sql, i)
+			b.WriteString(strings.TrimRight(sql[i:end], "\n"))
+			i = end
+		case c == '$' && i+1 < len(sql) && isDigitByte(sql[i+1]):
+			i++
+			for i < len(sql) && isDigitByte(sql[i]) {
+				i++
+			}
+			b.WriteByte('?')
+		case isDigitByte(c):
+			for i < len(sql) && (isIdentByte(sql[i]) || sql[i] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+		case isIdentByte(c):
+			start := i
+			for i < len(sql) && isIdentByte(sql[i]) {
+				i++
+			}
+			b.WriteString(sql[start:i])
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// SQLHash returns the hex-encoded SHA-256 of the fingerprint of sql, so that
+// statements with the same shape share the same hash.
+func SQLHash(sql string) string {
+	return fingerprintHash(Fingerprint(sql))
+}
+
+func fingerprintHash(fingerprint string) string {
+	sum := sha256.Sum256([]byte(fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// sqlKeywords are the keywords upper-cased by normalizeKeywordCase.
+var sqlKeywords = map[string]bool{
+	"ALL": true, "ALTER": true, "AND": true, "ANY": true, "AS": true,
+	"ASC": true, "BEGIN": true, "BETWEEN": true, "BY": true, "CASE": true,
+	"CAST": true, "COMMIT": true, "CONFLICT": true, "COUNT": true,
+	"CREATE": true, "CROSS": true, "DEFAULT": true, "DELETE": true,
+	"DESC": true, "DISTINCT": true, "DO": true, "DROP": true, "ELSE": true,
+	"END": true, "EXCEPT": true, "EXISTS": true, "FALSE": true,
+	"FETCH": true, "FOR": true, "FROM": true, "FULL": true, "GROUP": true,
+	"HAVING": true, "ILIKE": true, "IN": true, "INNER": true,
+	"INSERT": true, "INTERSECT": true, "INTO": true, "IS": true,
+	"JOIN": true, "KEY": true, "LEFT": true, "LIKE": true, "LIMIT": true,
+	"LOCK": true, "NOT": true, "NOTHING": true, "NULL": true,
+	"OFFSET": true, "ON": true, "OR": true, "ORDER": true, "OUTER": true,
+	"RETURNING": true, "RIGHT": true, "ROLLBACK": true, "SAVEPOINT": true,
+	"SELECT": true, "SET": true, "SHARE": true, "TABLE": true,
+	"THEN": true, "TRUE": true, "UNION": true, "UPDATE": true,
+	"USING": true, "VALUES": true, "WHEN": true, "WHERE": true,
+	"WITH": true,
+}
+
+// normalizeKeywordCase upper-cases the keywords of a fingerprint, leaving
+// its quoted identifiers, comments and other identifiers as is, so that
+// equivalent statements with a different keyword casing share the same
+// fingerprint.
+func normalizeKeywordCase(fingerprint string) string {
+	var b strings.Builder
+	b.Grow(len(fingerprint))
+	for i := 0; i < len(fingerprint); {
+		c := fingerprint[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(fingerprint, i)
+			b.WriteString(fingerprint[i:end])
+			i = end
+		case strings.HasPrefix(fingerprint[i:], "--") || strings.HasPrefix(fingerprint[i:], "/*"):
+			end := commentEnd(fingerprint, i)
+			b.WriteString(fingerprint[i:end])
+			i = end
+		case isIdentByte(c):
+			start := i
+			for i < len(fingerprint) && isIdentByte(fingerprint[i]) {
+				i++
+			}
+			word := fingerprint[start:i]
+			if upper := strings.ToUpper(word); sqlKeywords[upper] {
+				word = upper
+			}
+			b.WriteString(word)
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// quotedEnd returns the index following the quoted string or identifier
+// starting at sql[start], handling doubled and backslash-escaped quotes.
+func quotedEnd(sql string, start int) int {
+	quote := sql[start]
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if quote == '\'' {
+				i++
+			}
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// commentEnd returns the index following the -- or /* */ comment starting at
+// sql[start].
+func commentEnd(sql string, start int) int {
+	if strings.HasPrefix(sql[start:], "--") {
+		if end := strings.IndexByte(sql[start:], '\n'); end >= 0 {
+			return start + end + 1
+		}
+		return len(sql)
+	}
+	if end := strings.Index(sql[start+2:], "*/"); end >= 0 {
+		return start + 2 + end + 2
+	}
+	return len(sql)
+}
+
+func isDigitByte(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// countPlaceholders returns the number of ? placeholders of a fingerprint,
+// ignoring the ones in quoted identifiers and comments.
+func countPlaceholders(fingerprint string) int {
+	n := 0
+	for i := 0; i < len(fingerprint); {
+		switch c := fingerprint[i]; {
+		case c == '"' || c == '`':
+			i = quotedEnd(fingerprint, i)
+		case strings.HasPrefix(fingerprint[i:], "--") || strings.HasPrefix(fingerprint[i:], "/*"):
+			i = commentEnd(fingerprint, i)
+		default:
+			if c == '?' {
+				n++
+			}
+			i++
+		}
+	}
+	return n
+}
+
+// Placeholder styles returned by placeholderStyle.
+const (
+	placeholderNone   = "none"
+	placeholderQMark  = "qmark"
+	placeholderDollar = "dollar"
+	placeholderNamed  = "named"
+	placeholderMixed  = "mixed"
+)
+
+// placeholderStyle returns the style of the placeholders of sql: ? (qmark),
+// $1 (dollar), :name or @name (named), mixed or none, ignoring string
+// literals, quoted identifiers and comments.
+func placeholderStyle(sql string) string {
+	style := placeholderNone
+	found := func(s string) {
+		switch style {
+		case placeholderNone:
+			style = s
+		case s:
+		default:
+			style = placeholderMixed
+		}
+	}
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = quotedEnd(sql, i)
+			continue
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			i = commentEnd(sql, i)
+			continue
+		case c == '?':
+			found(placeholderQMark)
+		case c == '$' && i+1 < len(sql) && isDigitByte(sql[i+1]):
+			found(placeholderDollar)
+		case (c == ':' || c == '@') && i+1 < len(sql) && isIdentByte(sql[i+1]) && !isDigitByte(sql[i+1]) &&
+			(i == 0 || sql[i-1] != ':' && sql[i-1] != '@' && !isIdentByte(sql[i-1])):
+			found(placeholderNamed)
+		case isIdentByte(c):
+			for i < len(sql) && isIdentByte(sql[i]) {
+				i++
+			}
+			continue
+		}
+		i++
+	}
+	return style
+}
+
+// hasWhereClause reports whether sql contains the WHERE keyword outside of
+// string literals, quoted identifiers and comments.
+func hasWhereClause(sql string) bool {
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = quotedEnd(sql, i)
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			i = commentEnd(sql, i)
+		case isIdentByte(c):
+			end := i
+			for end < len(sql) && isIdentByte(sql[end]) {
+				end++
+			}
+			if strings.EqualFold(sql[i:end], "WHERE") {
+				return true
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	return false
+}
+
+// tableCount returns the number of distinct tables referenced by the
+// fingerprint of a statement: the names following FROM, JOIN, UPDATE and INTO,
+// and the comma-separated ones of FROM clauses. Subqueries are counted by
+// their own FROM clauses, and table functions or expressions like
+// EXTRACT(YEAR FROM t) may be miscounted.
+func tableCount(fingerprint string) int {
+	tokens := sqlTokens(fingerprint)
+	tables := make(map[string]bool)
+	for i, token := range tokens {
+		switch strings.ToUpper(token) {
+		case "FROM", "JOIN", "INTO":
+		case "UPDATE":
+			// FOR UPDATE and ON DUPLICATE KEY UPDATE do not name a table.
+			if i > 0 && (strings.EqualFold(tokens[i-1], "FOR") || strings.EqualFold(tokens[i-1], "KEY")) {
+				continue
+			}
+		default:
+			continue
+		}
+		j := i + 1
+		for j < len(tokens) && tableKeywords[strings.ToUpper(tokens[j])] {
+			j++
+		}
+		for j < len(tokens) && isTableToken(tokens[j]) {
+			tables[tableName(tokens[j])] = true
+			j++
+			if j < len(tokens) && strings.EqualFold(tokens[j], "AS") {
+				j++
+			}
+			if j < len(tokens) && isTableToken(tokens[j]) {
+				j++ // alias
+			}
+			if j >= len(tokens) || tokens[j] != "," {
+				break
+			}
+			j++
+		}
+	}
+	return len(tables)
+}
+
+// sqlTokens splits sql into names, possibly quoted and qualified like
+// `schema`.`table`, and single-byte punctuation, skipping whitespace,
+// comments and string literals.
+func sqlTokens(sql string) []string {
+	var tokens []string
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case isSpaceByte(c):
+			i++
+		case c == '\'':
+			i = quotedEnd(sql, i)
+			tokens = append(tokens, "?")
+		case strings.HasPrefix(sql[i:], "--") || strings.HasPrefix(sql[i:], "/*"):
+			i = commentEnd(sql, i)
+		case c == '"' || c == '`' || isIdentByte(c):
+			start := i
+			for i < len(sql) {
+				if sql[i] == '"' || sql[i] == '`' {
+					i = quotedEnd(sql, i)
+				} else if isIdentByte(sql[i]) || sql[i] == '.' {
+					i++
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, sql[start:i])
+		default:
+			tokens = append(tokens, sql[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+// tableKeywords are the keywords around table names that are not in
+// sqlKeywords, whose changes would alter fingerprints: ONLY and LATERAL
+// precede a table, NATURAL a join.
+var tableKeywords = map[string]bool{"LATERAL": true, "NATURAL": true, "ONLY": true}
+
+// isTableToken reports whether token may be a table name or alias: a name
+// that is not a keyword nor a number.
+func isTableToken(token string) bool {
+	c := token[0]
+	if c == '"' || c == '`' {
+		return true
+	}
+	upper := strings.ToUpper(token)
+	return isIdentByte(c) && !isDigitByte(c) && !sqlKeywords[upper] && !tableKeywords[upper]
+}
+
+// tableName returns the unquoted, lower-cased name of a table token.
+func tableName(token string) string {
+	return strings.ToLower(strings.NewReplacer(`"`, "", "`", "").Replace(token))
+}
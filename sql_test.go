@@ -0,0 +1,30 @@
+package zapgorm2_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"moul.io/zapgorm2"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		sql         string
+		fingerprint string
+	}{
+		{"SELECT * FROM `users` WHERE id = 42", "SELECT * FROM `users` WHERE id = ?"},
+		{"SELECT *\n\tFROM users WHERE name = 'it''s' AND age > 1.5", "SELECT * FROM users WHERE name = ? AND age > ?"},
+		{`SELECT "col1" FROM t2 WHERE a = $1 AND b IN ($2, $3)`, `SELECT "col1" FROM t2 WHERE a = ? AND b IN (?, ?)`},
+		{"SELECT 1 /* it's 2 */ -- 3\n", "SELECT ? /* it's 2 */ -- 3"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.fingerprint, zapgorm2.Fingerprint(tt.sql), tt.sql)
+	}
+}
+
+func TestSQLHash(t *testing.T) {
+	hash := zapgorm2.SQLHash("SELECT * FROM users WHERE id = 1")
+	require.Len(t, hash, 64)
+	require.Equal(t, hash, zapgorm2.SQLHash("SELECT *  FROM users WHERE id = 2"))
+	require.NotEqual(t, hash, zapgorm2.SQLHash("SELECT * FROM posts WHERE id = 1"))
+}
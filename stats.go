@@ -0,0 +1,44 @@
+package zapgorm2
+
+import "sync/atomic"
+
+// Stats are the counters of a logger, shared by its copies.
+type Stats struct {
+	// SlowQueries is the number of slow queries traced.
+	SlowQueries int64
+	// SuppressedSlowQueries is the number of slow queries not passed to
+	// OnSlowQuery, nor logged with SampleSlowLog, due to
+	// SlowQuerySampleRate.
+	SuppressedSlowQueries int64
+}
+
+// Stats returns the counters of the logger, which are zero for a logger not
+// created by New.
+func (l Logger) Stats() Stats {
+	if l.slowStats == nil {
+		return Stats{}
+	}
+	return Stats{
+		SlowQueries:           atomic.LoadInt64(&l.slowStats.seen),
+		SuppressedSlowQueries: atomic.LoadInt64(&l.slowStats.suppressed),
+	}
+}
+
+type slowQueryStats struct {
+	seen       int64
+	suppressed int64
+}
+
+// sampleSlowQuery counts a slow query and reports whether it is sampled, the
+// first one of every SlowQuerySampleRate being kept.
+func (l Logger) sampleSlowQuery() bool {
+	if l.slowStats == nil {
+		return true
+	}
+	n := atomic.AddInt64(&l.slowStats.seen, 1)
+	if l.SlowQuerySampleRate <= 1 || (n-1)%int64(l.SlowQuerySampleRate) == 0 {
+		return true
+	}
+	atomic.AddInt64(&l.slowStats.suppressed, 1)
+	return false
+}
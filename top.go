@@ -0,0 +1,164 @@
+package zapgorm2
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultTopQueriesFingerprints = 1000
+	defaultTopQueriesInterval     = time.Minute
+)
+
+// WithTopQueries returns a copy of the logger counting the traced queries by
+// Fingerprint and logging, every interval, the n fingerprints (10 when n is
+// not positive) with the most queries and the ones with the most total time
+// over that interval (a minute when interval is not positive, which
+// Validate reports), e.g. for capacity planning.
+//
+// At most 1000 fingerprints are counted per interval, the least recently
+// seen ones being evicted, so rare fingerprints may be undercounted under a
+// high cardinality. As the SQL is needed to compute fingerprints, the SQL
+// callback of GORM is called for every traced query. With SQLModeHashOnly,
+// the fingerprints are logged as their sql_hash instead.
+//
+// The background goroutine is stopped by Close.
+func (l Logger) WithTopQueries(interval time.Duration, n int) Logger {
+	if n <= 0 {
+		n = 10
+	}
+	t := &topQueries{
+		n:               n,
+		size:            defaultTopQueriesFingerprints,
+		stats:           newLRU(defaultTopQueriesFingerprints),
+		invalidInterval: interval <= 0,
+		done:            make(chan struct{}),
+	}
+	if interval <= 0 {
+		interval = defaultTopQueriesInterval
+	}
+	go t.run(l.ZapLogger, interval)
+	l.top = t
+	return l
+}
+
+type topQueries struct {
+	n               int
+	size            int
+	invalidInterval bool // reported by Validate
+
+	mu    sync.Mutex
+	stats *lru
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// topQuery are the statistics of a fingerprint over an interval. With
+// hashed, fingerprint is the hash of the fingerprint, see SQLModeHashOnly.
+type topQuery struct {
+	fingerprint string
+	hashed      bool
+	count       int64
+	total       time.Duration
+}
+
+func (q topQuery) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if q.hashed {
+		enc.AddString("sql_hash", q.fingerprint)
+	} else {
+		enc.AddString("fingerprint", q.fingerprint)
+	}
+	enc.AddInt64("count", q.count)
+	enc.AddDuration("total_time", q.total)
+	return nil
+}
+
+type topQueryList []topQuery
+
+func (l topQueryList) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, q := range l {
+		if err := enc.AppendObject(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *topQueries) add(fingerprint string, hashed bool, elapsed time.Duration) {
+	if hashed {
+		fingerprint = fingerprintHash(fingerprint)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if value, ok := t.stats.get(fingerprint); ok {
+		q := value.(*topQuery)
+		q.count++
+		q.total += elapsed
+		return
+	}
+	t.stats.add(fingerprint, &topQuery{fingerprint: fingerprint, hashed: hashed, count: 1, total: elapsed})
+}
+
+// reset empties the statistics and returns their content.
+func (t *topQueries) reset() []topQuery {
+	t.mu.Lock()
+	stats := t.stats
+	t.stats = newLRU(t.size)
+	t.mu.Unlock()
+
+	queries := make([]topQuery, 0, stats.len())
+	for _, elem := range stats.items {
+		queries = append(queries, *elem.Value.(*lruEntry).value.(*topQuery))
+	}
+	return queries
+}
+
+// top returns the n first queries sorted by less, ties being broken by
+// fingerprint so that reports are stable.
+func (t *topQueries) top(queries []topQuery, less func(a, b topQuery) bool) topQueryList {
+	sorted := make([]topQuery, len(queries))
+	copy(sorted, queries)
+	sort.Slice(sorted, func(i, j int) bool {
+		if less(sorted[i], sorted[j]) {
+			return true
+		}
+		if less(sorted[j], sorted[i]) {
+			return false
+		}
+		return sorted[i].fingerprint < sorted[j].fingerprint
+	})
+	if len(sorted) > t.n {
+		sorted = sorted[:t.n]
+	}
+	return sorted
+}
+
+func (t *topQueries) run(logger *zap.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			queries := t.reset()
+			if len(queries) == 0 {
+				continue
+			}
+			logger.Info("top queries",
+				zap.Int("fingerprints", len(queries)),
+				zap.Array("by_count", t.top(queries, func(a, b topQuery) bool { return a.count > b.count })),
+				zap.Array("by_time", t.top(queries, func(a, b topQuery) bool { return a.total > b.total })),
+			)
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *topQueries) stop() {
+	t.stopOnce.Do(func() { close(t.done) })
+}
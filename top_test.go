@@ -0,0 +1,73 @@
+package zapgorm2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"moul.io/zapgorm2"
+)
+
+func TestTopQueries(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zapgorm2.New(zap.New(core)).WithTopQueries(50*time.Millisecond, 2)
+	defer logger.Close()
+	ctx := context.Background()
+	trace := func(sql string, elapsed time.Duration) {
+		logger.Trace(ctx, time.Now().Add(-elapsed), func() (string, int64) { return sql, 1 }, nil)
+	}
+
+	for i := 0; i < 5; i++ {
+		trace("SELECT * FROM users WHERE id = 1", time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		trace("SELECT * FROM orders WHERE id = 2", time.Millisecond)
+	}
+	trace("SELECT * FROM reports", 10*time.Second)
+
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("top queries").Len() > 0
+	}, time.Second, 5*time.Millisecond)
+	fields := logs.FilterMessage("top queries").All()[0].ContextMap()
+	require.Equal(t, int64(3), fields["fingerprints"])
+	byCount := fields["by_count"].([]interface{})
+	require.Len(t, byCount, 2)
+	require.Equal(t, "SELECT * FROM users WHERE id = ?", byCount[0].(map[string]interface{})["fingerprint"])
+	require.Equal(t, int64(5), byCount[0].(map[string]interface{})["count"])
+	require.Equal(t, "SELECT * FROM orders WHERE id = ?", byCount[1].(map[string]interface{})["fingerprint"])
+	byTime := fields["by_time"].([]interface{})
+	require.Len(t, byTime, 2)
+	require.Equal(t, "SELECT * FROM reports", byTime[0].(map[string]interface{})["fingerprint"])
+	require.Equal(t, int64(1), byTime[0].(map[string]interface{})["count"])
+}
+
+func TestTopQueriesHashOnly(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zapgorm2.New(zap.New(core)).WithTopQueries(50*time.Millisecond, 2)
+	defer logger.Close()
+	logger.SQLMode = zapgorm2.SQLModeHashOnly
+	sql := "SELECT * FROM users WHERE email = 'a@example.com'"
+	logger.Trace(context.Background(), time.Now(), func() (string, int64) { return sql, 1 }, nil)
+
+	require.Eventually(t, func() bool {
+		return logs.FilterMessage("top queries").Len() > 0
+	}, time.Second, 5*time.Millisecond)
+	byCount := logs.FilterMessage("top queries").All()[0].ContextMap()["by_count"].([]interface{})
+	require.Len(t, byCount, 1)
+	require.Equal(t, map[string]interface{}{
+		"sql_hash":   zapgorm2.SQLHash(sql),
+		"count":      int64(1),
+		"total_time": byCount[0].(map[string]interface{})["total_time"],
+	}, byCount[0], "SQLModeHashOnly logs no SQL text")
+}
+
+func TestTopQueriesNonPositiveInterval(t *testing.T) {
+	// A ticker panic in the background goroutine would crash the test binary.
+	logger := zapgorm2.New(zap.NewNop()).WithTopQueries(0, 10)
+	logger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 1", 1 }, nil)
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, logger.Close())
+}
@@ -0,0 +1,89 @@
+package zapgorm2
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultLongTxnMessage = "long transaction"
+
+type transactionCtxKey struct{}
+
+// transactionState is the time the current transaction of a context began,
+// in Unix nanoseconds, or 0.
+type transactionState struct {
+	begin int64
+}
+
+// ContextWithTransaction returns a context in which the BEGIN and COMMIT or
+// ROLLBACK statements traced by the logger are correlated, for
+// LongTxnThreshold and LogInTransaction. It is meant to wrap the context of
+// a single connection or session, e.g.
+// db.WithContext(ContextWithTransaction(ctx)).
+func ContextWithTransaction(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transactionCtxKey{}, &transactionState{})
+}
+
+// transactionDuration records the beginning of the transaction of ctx at a
+// BEGIN statement, and returns its duration at the COMMIT or ROLLBACK
+// statement ending it.
+func transactionDuration(ctx context.Context, query *tracedQuery, begin time.Time, elapsed time.Duration) (time.Duration, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	state, ok := ctx.Value(transactionCtxKey{}).(*transactionState)
+	if !ok {
+		return 0, false
+	}
+	switch query.verb() {
+	case "BEGIN", "START":
+		atomic.StoreInt64(&state.begin, begin.UnixNano())
+	case "COMMIT", "ROLLBACK", "END":
+		if query.verb() == "ROLLBACK" && isSavepointRollback(query.rawSQL()) {
+			break
+		}
+		if started := atomic.SwapInt64(&state.begin, 0); started != 0 {
+			return time.Duration(begin.Add(elapsed).UnixNano() - started), true
+		}
+	}
+	return 0, false
+}
+
+// isSavepointRollback reports whether sql, a ROLLBACK statement, rolls back
+// to a savepoint, which does not end the transaction.
+func isSavepointRollback(sql string) bool {
+	word := func(i int) (string, int) {
+		i = skipSpaceAndComments(sql, i)
+		start := i
+		for i < len(sql) && isIdentByte(sql[i]) {
+			i++
+		}
+		return strings.ToUpper(sql[start:i]), i
+	}
+	_, i := word(0)
+	next, i := word(i)
+	if next == "WORK" || next == "TRANSACTION" {
+		next, _ = word(i)
+	}
+	return next == "TO"
+}
+
+// isInTransaction reports whether the statement traced with ctx runs in a
+// transaction: a GORM transaction, or one whose BEGIN statement was traced
+// with a context returned by ContextWithTransaction.
+func isInTransaction(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	if stmt := statementFromContext(ctx); stmt != nil {
+		if _, ok := stmt.ConnPool.(gorm.TxCommitter); ok {
+			return true
+		}
+	}
+	state, ok := ctx.Value(transactionCtxKey{}).(*transactionState)
+	return ok && atomic.LoadInt64(&state.begin) != 0
+}
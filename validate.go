@@ -0,0 +1,80 @@
+package zapgorm2
+
+import (
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// NewStrict is like New, with configure applied to the logger, but returns
+// an error when the resulting configuration is invalid, see Validate.
+func NewStrict(zapLogger *zap.Logger, configure func(*Logger)) (Logger, error) {
+	l := New(zapLogger)
+	if configure != nil {
+		configure(&l)
+	}
+	if err := l.Validate(); err != nil {
+		return Logger{}, err
+	}
+	return l, nil
+}
+
+// Validate reports the invalid or contradictory settings of the logger,
+// which are otherwise silently tolerated:
+//
+//   - a nil ZapLogger,
+//   - a LogLevel, SQLMode, CallerFormat, RowsMode or EncoderKind out of
+//     the defined values,
+//   - a negative MaxArgsLength, MaxAffectedRows, NearDeadlineMargin or
+//     SlowQuerySampleRate,
+//   - SlowQuietHours out of [0, 24h),
+//   - a ConditionalFields rule with a nil When or Field,
+//   - a non-positive interval given to WithLatencySummary or
+//     WithTopQueries,
+//   - AutoStructured with EncoderKindUnknown, which has no effect,
+//   - SQLFormatter with SQLModeHashOnly, which logs no SQL to format,
+//   - InlineParamsForDebug with SQLModeHashOnly, which logs no SQL text,
+//   - CallerFormatFunc or SuppressCallerForPackages with SkipCallerLookup,
+//     which looks up no caller,
+//   - LogArgsOnError with LogSQLArgs, which already logs all the args,
+//   - DiagnoseConfig without SlowThreshold.
+func (l Logger) Validate() error {
+	var problems []string
+	check := func(invalid bool, problem string) {
+		if invalid {
+			problems = append(problems, problem)
+		}
+	}
+	check(l.ZapLogger == nil, "ZapLogger is nil")
+	check(l.LogLevel < gormlogger.Silent || l.LogLevel > gormlogger.Info, "LogLevel is not a gorm log level")
+	check(l.SQLMode != SQLModeFull && l.SQLMode != SQLModeHashOnly, "unknown SQLMode")
+	check(l.CallerFormat != CallerFormatFull && l.CallerFormat != CallerFormatBase, "unknown CallerFormat")
+	check(l.RowsMode != RowsModeAlways && l.RowsMode != RowsModeSkipRaw, "unknown RowsMode")
+	check(l.EncoderKind < EncoderKindUnknown || l.EncoderKind > EncoderKindConsole, "unknown EncoderKind")
+	check(l.MaxArgsLength < 0, "MaxArgsLength is negative")
+	check(l.MaxAffectedRows < 0, "MaxAffectedRows is negative")
+	check(l.NearDeadlineMargin < 0, "NearDeadlineMargin is negative")
+	check(l.SlowQuerySampleRate < 0, "SlowQuerySampleRate is negative")
+	check(!validTimeOfDayRanges(l.SlowQuietHours), "SlowQuietHours out of [0, 24h)")
+	for _, rule := range l.ConditionalFields {
+		if rule.When == nil || rule.Field == nil {
+			problems = append(problems, "ConditionalFields rule with a nil When or Field")
+			break
+		}
+	}
+	check(l.latency != nil && l.latency.invalidInterval, "WithLatencySummary interval is not positive")
+	check(l.top != nil && l.top.invalidInterval, "WithTopQueries interval is not positive")
+	check(l.AutoStructured && l.EncoderKind == EncoderKindUnknown, "AutoStructured requires an EncoderKind")
+	check(l.SQLFormatter != nil && l.SQLMode == SQLModeHashOnly, "SQLFormatter has no effect with SQLModeHashOnly")
+	check(l.InlineParamsForDebug && l.SQLMode == SQLModeHashOnly, "InlineParamsForDebug has no effect with SQLModeHashOnly")
+	check(l.CallerFormatFunc != nil && l.SkipCallerLookup, "CallerFormatFunc has no effect with SkipCallerLookup")
+	check(len(l.SuppressCallerForPackages) > 0 && l.SkipCallerLookup, "SuppressCallerForPackages has no effect with SkipCallerLookup")
+	check(l.LogArgsOnError && l.LogSQLArgs, "LogArgsOnError has no effect with LogSQLArgs")
+	check(l.DiagnoseConfig && l.SlowThreshold <= 0, "DiagnoseConfig requires a SlowThreshold")
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("zapgorm2: invalid logger configuration: " + strings.Join(problems, "; "))
+}
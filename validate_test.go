@@ -0,0 +1,60 @@
+package zapgorm2_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"moul.io/zapgorm2"
+)
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, zapgorm2.New(zap.NewNop()).Validate())
+
+	tests := []struct {
+		name      string
+		configure func(*zapgorm2.Logger)
+		err       string
+	}{
+		{"nil zap logger", func(l *zapgorm2.Logger) { l.ZapLogger = nil }, "ZapLogger is nil"},
+		{"unknown level", func(l *zapgorm2.Logger) { l.LogLevel = 42 }, "LogLevel is not a gorm log level"},
+		{"negative max args length", func(l *zapgorm2.Logger) { l.MaxArgsLength = -1 }, "MaxArgsLength is negative"},
+		{"auto structured without kind", func(l *zapgorm2.Logger) { l.AutoStructured = true }, "AutoStructured requires an EncoderKind"},
+		{"formatter with hash only", func(l *zapgorm2.Logger) {
+			l.SQLMode = zapgorm2.SQLModeHashOnly
+			l.SQLFormatter = func(sql string) string { return sql }
+		}, "SQLFormatter has no effect with SQLModeHashOnly"},
+		{"inlined params with hash only", func(l *zapgorm2.Logger) {
+			l.SQLMode = zapgorm2.SQLModeHashOnly
+			l.InlineParamsForDebug = true
+		}, "InlineParamsForDebug has no effect with SQLModeHashOnly"},
+		{"args on error with args", func(l *zapgorm2.Logger) {
+			l.LogSQLArgs, l.LogArgsOnError = true, true
+		}, "LogArgsOnError has no effect with LogSQLArgs"},
+		{"quiet hours out of day", func(l *zapgorm2.Logger) {
+			l.SlowQuietHours = []zapgorm2.TimeOfDayRange{{Start: 22 * time.Hour, End: 30 * time.Hour}}
+		}, "SlowQuietHours out of [0, 24h)"},
+		{"latency summary without interval", func(l *zapgorm2.Logger) {
+			*l = l.WithLatencySummary(-time.Second, 0)
+			l.Close()
+		}, "WithLatencySummary interval is not positive"},
+		{"top queries without interval", func(l *zapgorm2.Logger) {
+			*l = l.WithTopQueries(0, 10)
+			l.Close()
+		}, "WithTopQueries interval is not positive"},
+		{"conditional field without field", func(l *zapgorm2.Logger) {
+			l.ConditionalFields = []zapgorm2.ConditionalField{{When: func(zapgorm2.TraceInfo) bool { return true }}}
+		}, "ConditionalFields rule with a nil When or Field"},
+		{"several problems", func(l *zapgorm2.Logger) {
+			l.MaxAffectedRows, l.NearDeadlineMargin = -1, -1
+		}, "MaxAffectedRows is negative; NearDeadlineMargin is negative"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := zapgorm2.NewStrict(zap.NewNop(), tt.configure)
+			require.EqualError(t, err, "zapgorm2: invalid logger configuration: "+tt.err)
+		})
+	}
+}
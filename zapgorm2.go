@@ -3,10 +3,15 @@ package zapgorm2
 import (
 	"context"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -16,23 +21,557 @@ import (
 
 type ContextFn func(ctx context.Context) []zapcore.Field
 
+// TraceFieldsFn returns extra fields for a Trace entry; file is the caller
+// rendered according to CallerFormat, empty when SkipCallerLookup is set.
+type TraceFieldsFn func(ctx context.Context, sql string, rows int64, elapsed time.Duration, file string, err error) []zapcore.Field
+
+// Logger is a GORM logger writing to a zap.Logger.
+//
+// It can be embedded to override some of its methods. As GORM replaces its
+// logger by the result of LogMode for db.Debug() and sessions, the embedding
+// type must also override LogMode to wrap the Logger it returns. Note that
+// the overriding methods are then reported as the caller of the entries.
 type Logger struct {
-	ZapLogger                 *zap.Logger
-	LogLevel                  gormlogger.LogLevel
-	SlowThreshold             time.Duration
-	SkipCallerLookup          bool
+	ZapLogger *zap.Logger
+	// CoreFor, when set, returns the core the entries of a context at a
+	// level are written to instead of the core of ZapLogger, e.g. to route
+	// each tenant to its own sink, ZapLogger still providing the name and
+	// options. It is called for every entry, and the loggers of the last
+	// 64 comparable cores, like the pointers returned by zapcore.NewCore,
+	// are cached; other cores cost a logger copy per entry. Returning nil
+	// writes to ZapLogger.
+	CoreFor  func(ctx context.Context, level zapcore.Level) zapcore.Core
+	LogLevel gormlogger.LogLevel
+	// SlowThreshold is the elapsed time above which a query is logged as slow.
+	// Zero or a negative value disables slow query detection.
+	SlowThreshold time.Duration
+	// SlowQuietHours are the times of day, in TimeZone, during which slow
+	// queries are expected, e.g. nightly batch windows: their slow_query
+	// entries are logged at info level instead of warn level, and
+	// OnSlowQuery is not called for them.
+	SlowQuietHours []TimeOfDayRange
+	// DiagnoseConfig logs once at debug level when the deadline of a traced
+	// query's context is shorter than SlowThreshold, since such queries time
+	// out before they can be flagged as slow.
+	DiagnoseConfig bool
+	// NearDeadlineMargin, when positive, adds a near_deadline=true field to
+	// the Trace entries of the queries ending within that margin of their
+	// context deadline, which are logged at warn level at least.
+	NearDeadlineMargin time.Duration
+	SkipCallerLookup   bool
+	// SuppressCallerForPackages omits the caller of the entries whose first
+	// frame outside of gorm and zapgorm2 belongs to one of these packages,
+	// matched in the file path like "github.com/acme/repository/", when no
+	// caller is better than a misleading one. No further frame is looked up.
+	SuppressCallerForPackages []string
+	// CallerFormat controls how the caller is rendered. CallerFormatFunc,
+	// when set, takes precedence and is used like CallerFormatBase. Like
+	// the caller annotated by zap, the caller field is only logged when
+	// ZapLogger is built with zap.AddCaller.
+	CallerFormat              CallerFormat
+	CallerFormatFunc          func(file string, line int) string
 	IgnoreRecordNotFoundError bool
 	Context                   ContextFn
+	// RecoverContextFunc recovers from the panics of Context, which are then
+	// logged at debug level, the entries being logged without its fields.
+	RecoverContextFunc bool
+	// GenerateCorrelationID adds a correlation_id field to the entries of
+	// contexts returned by ContextWithCorrelationID, unless Context already
+	// returns a correlation_id field.
+	GenerateCorrelationID bool
+	// Version, when set, is logged as app_version on every entry, e.g. to
+	// correlate the behavior of queries with releases. NewWithBuildInfo
+	// sets it from the build information of the binary.
+	Version string
+	// Host and Port, when set, are logged as db_host and db_port on every
+	// entry, e.g. to tell a primary from its replicas. NewForDB sets them
+	// from the DSN of a dialector.
+	Host string
+	Port int
+	// Enabled, when set, is called by every method and disables all the
+	// entries of the logger while it returns false, e.g. to plug a feature
+	// flag. The callbacks (Metrics, OnSlowQuery, ...) keep being called, and
+	// a Tee logger keeps receiving calls. It must be cheap.
+	Enabled func() bool
+	// NoLogMarker, when set, disables the Trace entries of the statements
+	// containing it, typically in a comment like /* zapgorm2:nolog */,
+	// unless they fail. The callbacks are still called.
+	NoLogMarker string
+	// ErrorField, when set, renders the error of failed queries as a field,
+	// instead of zap.Error.
+	ErrorField func(err error) zapcore.Field
+	// MaxAffectedRows, when positive, logs at warn level the UPDATE and
+	// DELETE statements affecting more rows, as "unexpectedly large write".
+	MaxAffectedRows int64
+	// ExpectedMaxRows is the maximum number of rows of queries by
+	// Fingerprint, e.g. 1 for a lookup by unique key. The queries returning
+	// or affecting more rows are logged at warn level as "more rows than
+	// expected", with an expected_max_rows field. The other fingerprints
+	// are not checked.
+	ExpectedMaxRows map[string]int64
+	// OperationLevels overrides the debug level of regular Trace entries
+	// by SQL verb, e.g. {"INSERT": zapcore.InfoLevel} to log writes at info
+	// level. Keys are upper case.
+	OperationLevels map[string]zapcore.Level
+	// MinLogDuration, when positive, skips the regular Trace entries of the
+	// queries faster than it with the Info LogLevel. Unlike SlowThreshold,
+	// it doesn't change any level: failed and slow queries are still logged,
+	// and the callbacks still see every query.
+	MinLogDuration time.Duration
+	// LogIfTraceSampled skips the regular Trace entries of the queries whose
+	// trace is not sampled, as reported by TraceSampled, e.g.
+	// zapgorm2otel.TraceSampled for OpenTelemetry, so that the SQL logs
+	// follow the trace sampling. The queries without trace, for which
+	// TraceSampled returns false as its second value, are logged as usual,
+	// and so are failed and slow queries.
+	LogIfTraceSampled bool
+	TraceSampled      func(ctx context.Context) (sampled bool, ok bool)
+	// WarnMissingWhere logs at warn level the UPDATE and DELETE statements
+	// without WHERE clause, unless they contain FullTableMarker.
+	WarnMissingWhere bool
+	// LongTxnThreshold, when positive, logs at warn level, with a
+	// txn_duration field, the COMMIT and ROLLBACK statements ending a
+	// transaction open for longer, in the contexts returned by
+	// ContextWithTransaction. Only the transactions whose BEGIN and COMMIT
+	// or ROLLBACK statements are traced are measured, e.g. with
+	// db.Exec("BEGIN"): GORM does not trace db.Begin nor db.Transaction.
+	LongTxnThreshold time.Duration
+	// LogInTransaction adds an in_transaction field to Trace entries, true
+	// for the statements run in a transaction: the statements of a
+	// transaction opened by GORM, e.g. with db.Transaction, which requires
+	// RegisterCallbacks or AttachTo, and the statements between the traced
+	// BEGIN and COMMIT or ROLLBACK statements of the contexts returned by
+	// ContextWithTransaction.
+	LogInTransaction bool
+	// LogEffectiveLevel adds an effective_level field with the level of the
+	// Trace entries once OperationLevels and ShutdownMode are applied, to
+	// debug why a query is logged or not.
+	LogEffectiveLevel bool
+	// SeverityField adds a field named SeverityKey, "severity" when empty,
+	// to every entry, set to the name of its level in SeverityNames, or by
+	// default the uppercase severity names of Google Cloud Logging (DEBUG,
+	// INFO, WARNING, ERROR, ...), for the systems ignoring the zap level.
+	SeverityField bool
+	SeverityKey   string
+	SeverityNames map[zapcore.Level]string
+	// ErrorLogOnce logs each kind of Trace error once, by SQLSTATE code or
+	// normalized message, and suppresses the repeats. The last 1000 kinds
+	// are remembered by the logger returned by New and its copies. The
+	// callbacks are still called.
+	ErrorLogOnce bool
+	// CatalogMode logs the SQL of a Trace entry along with its fingerprint
+	// the first time the fingerprint is logged, and only the fingerprint
+	// afterwards, for services with a fixed set of queries. The last 10000
+	// fingerprints are remembered by the logger returned by New and its
+	// copies. Failed queries are always logged with their SQL. It has no
+	// effect with SQLModeHashOnly, whose sql_hash already identifies the
+	// statements without logging their text.
+	CatalogMode bool
+	// StructuredMessages makes Info, Warn and Error log the raw format string
+	// and its arguments as fields instead of a formatted message.
+	StructuredMessages bool
+	// TrimMessage trims the trailing whitespace and newlines of the messages
+	// formatted by Info, Warn and Error, which some GORM format strings end
+	// with.
+	TrimMessage bool
+	// TagGormInternal adds a gorm_internal field set to true to the entries of
+	// Warn, through which GORM reports its own warnings, to tell them apart
+	// from the slow query and other warnings of Trace.
+	TagGormInternal bool
+	// AutoStructured picks the output according to EncoderKind: structured
+	// fields and StructuredMessages for JSON, and messages formatted like
+	// GORM's default logger, with DefaultGormFormatMsgFns, for the console.
+	// The encoder of a *zap.Logger cannot be inspected, so EncoderKind has
+	// to be set to the kind the logger was built with; with the zero
+	// EncoderKindUnknown, AutoStructured has no effect. Explicitly set
+	// message callbacks are kept.
+	AutoStructured bool
+	EncoderKind    EncoderKind
+	// AsyncDropOnFull makes WithAsyncWriter drop the entries instead of
+	// waiting when its queue is full.
+	AsyncDropOnFull bool
+	// OnLogDrop, when set at the time WithAsyncWriter is called, is called
+	// with the number of entries dropped due to AsyncDropOnFull since its
+	// previous call. It runs in the background goroutine of WithAsyncWriter,
+	// once there is room in the queue again, and within Close.
+	OnLogDrop func(dropped int)
+	// Namespace, when set, nests the fields added by the logger under a
+	// namespace of that name, e.g. gorm.sql and gorm.rows, so that they do
+	// not collide with the application fields. The fields returned by
+	// Context are not nested.
+	Namespace string
+	// DedupFields removes the duplicate keys of the fields of Trace entries,
+	// including the ones returned by Context, the last occurrence winning,
+	// e.g. a trace_id field returned by both Context and QueryFields. The
+	// fields nested under Namespace are deduplicated separately, and the
+	// fields of the zap logger itself are left untouched.
+	DedupFields bool
+	// QueryMessage, SlowMessage and ErrorMessage are the messages logged by
+	// Trace for regular, slow and failed queries; empty means "trace".
+	QueryMessage string
+	SlowMessage  string
+	ErrorMessage string
+	// EventField adds a gorm_event field set to EventQuery, EventSlowQuery or
+	// EventError, which stays stable when the messages above are customized.
+	EventField bool
+	// Fields is the set of the fields of Trace entries, FieldsDefault when
+	// zero, e.g. FieldSQL|FieldElapsed to build only those on the hot path.
+	// The Log* options of the fields out of FieldsDefault add them to it.
+	Fields FieldMask
+	// QueryMsgFn, SlowMsgFn and ErrorMsgFn, when set, build the message of
+	// the corresponding Trace entries, which then carry no structured
+	// fields besides the ones returned by Context.
+	QueryMsgFn TraceMsgFn
+	SlowMsgFn  TraceMsgFn
+	ErrorMsgFn TraceMsgFn
+	// HybridMode keeps the structured fields of the Trace entries whose
+	// message is built by QueryMsgFn, SlowMsgFn, ErrorMsgFn or
+	// AutoStructured, e.g. while migrating from GORM's text output, at the
+	// cost of logging the SQL, rows and elapsed time twice.
+	HybridMode bool
+	// TagDDL adds a migration=true field to DDL statements (CREATE, ALTER,
+	// DROP, ...), like ContextForMigration does for a whole context.
+	TagDDL bool
+	// StripSQLComments removes the -- and /* */ comments of the SQL given
+	// to Trace, before any other processing, so that they do not change
+	// fingerprints either. NoLogMarker and FullTableMarker still apply.
+	StripSQLComments bool
+	// CompactSQL collapses redundant whitespace in the logged SQL, which
+	// reduces the number of bytes encoded for multi-line statements.
+	CompactSQL bool
+	// CompactMode replaces the fields of Trace entries with a single q field
+	// like "op=select rows=3 elapsed=2ms", followed by event= and error= for
+	// the entries other than plain queries, for very high volumes where the
+	// cost of encoding and storing each field matters. It trades
+	// queryability for cost: the SQL and the fields of the optional features,
+	// QueryFields, SlowFields and ErrorFields are not logged.
+	CompactMode bool
+	// NormalizeKeywordCase upper-cases the SQL keywords of the fingerprints
+	// (sql_hash, the adaptive thresholds, ...), so that select and SELECT
+	// share the same one. The logged SQL is left as is.
+	NormalizeKeywordCase bool
+	// SQLFormatter, when set, rewrites the SQL of the sql field, e.g. to
+	// pretty-print it on a development console. It runs last, after
+	// CompactSQL and MaskColumns, and does not change fingerprints nor
+	// hashes.
+	SQLFormatter func(sql string) string
+	// TimeZone, when set, is the location of the times logged in fields and
+	// passed to the message callbacks; nil keeps the time.Now location.
+	TimeZone *time.Location
+	// LogQueryTime adds a query_time field with the time the query started.
+	LogQueryTime bool
+	// LogBeginTime adds a begin field with the time the query started, as
+	// given by GORM to Trace, e.g. to reconstruct timelines across systems.
+	LogBeginTime bool
+	// SQLMode controls how the SQL of Trace entries is logged. It applies to
+	// the structured fields, not to the TraceInfo given to the callbacks.
+	SQLMode SQLMode
+	// RowsMode controls when the rows field of Trace entries is logged.
+	// RowsFunc, when set, takes precedence and reports whether to log it.
+	RowsMode RowsMode
+	RowsFunc func(ctx context.Context, sql string) bool
+	// LogSQLArgs adds an args field with the bound variables of the query,
+	// serialized as JSON. It requires RegisterCallbacks to be called on the
+	// *gorm.DB, and may log sensitive values.
+	LogSQLArgs bool
+	// LogArgsOnError is like LogSQLArgs, for failed queries only. It has no
+	// effect when LogSQLArgs is set.
+	LogArgsOnError bool
+	// VerboseSlow adds the fields of the most verbose options to the slow
+	// query entries only, regardless of those options: the args field, as
+	// with LogSQLArgs, and a stack field with the stack trace of Trace.
+	VerboseSlow bool
+	// PostErrorVerboseCount, when positive, is the number of the queries
+	// following a failed query in a context returned by ContextForRequest
+	// that are logged verbosely: at info level, whatever LogLevel but
+	// Silent, with a post_error=true field and the args field, as with
+	// LogSQLArgs, e.g. to capture what a request does after a failure.
+	PostErrorVerboseCount int
+	// MaskColumns replaces with *** the values compared to these columns,
+	// in the SQL given to Trace and in the args field. Only the col = value
+	// and col IN (values) forms are recognized: values compared with other
+	// operators or through expressions, like LOWER(col) = value, are not
+	// masked.
+	MaskColumns []string
+	// RedactSQL rewrites the SQL given to Trace with Redactor, or
+	// DefaultRedactor when nil, after MaskColumns. A Redactor changing more
+	// than literals changes the fingerprints too.
+	RedactSQL bool
+	Redactor  Redactor
+	// LogArgsSummary adds an args_summary field with the type, and length
+	// for strings and byte slices, of the bound variables but not their
+	// value, e.g. "string(24), int, null". It requires RegisterCallbacks.
+	LogArgsSummary bool
+	// LogParamsHash adds a params_hash field with the SHA-256 of the bound
+	// variables, masked by MaskColumns, serialized like the args field, to
+	// group the executions with the same parameters without logging them.
+	// It requires RegisterCallbacks.
+	LogParamsHash bool
+	// InlineParamsForDebug adds a sql_inlined field with the statement SQL
+	// in which the bound variables, masked by MaskColumns, are inlined as
+	// SQL literals, to be copied into a SQL console, and then redacted like
+	// the sql field with RedactSQL. It is a debugging aid: like LogSQLArgs,
+	// it logs the values of the queries, which may contain personal data.
+	// It requires RegisterCallbacks, and logs nothing with SQLModeHashOnly.
+	InlineParamsForDebug bool
+	// LogCallback adds a callback field with the GORM callback processor
+	// that ran the query: create, query, update, delete, row or raw. It
+	// requires RegisterCallbacks, and is best effort: statements run by
+	// other means, like migrations, have no such field.
+	LogCallback bool
+	// LogModel adds a model field with the name of the Go type of the GORM
+	// model of the query, e.g. User, or the one given to ContextWithModel.
+	// Like LogCallback, it requires RegisterCallbacks, and there is no
+	// field for the statements without model, like most raw SQL.
+	LogModel bool
+	// MaxArgsLength, when positive, truncates the serialized args to that
+	// many bytes, adding an args_truncated field when it happens.
+	MaxArgsLength int
+	// LogParamCount adds a param_count field with the number of parameters
+	// of the statement, counted on its Fingerprint: as GORM inlines bound
+	// variables in the SQL, this counts both placeholders and literals.
+	LogParamCount bool
+	// LogTableCount adds a table_count field with the number of distinct
+	// tables the statement names after FROM, JOIN, UPDATE and INTO, counted
+	// on its Fingerprint. The count is best-effort: the tables of subqueries
+	// are included, and table functions may be miscounted.
+	LogTableCount bool
+	// LogPlaceholderStyle adds a placeholder_style field telling which
+	// placeholders the SQL contains: qmark (?), dollar ($1), named (:name or
+	// @name), mixed or none. GORM inlines bound variables when explaining the
+	// SQL, so placeholders are usually left by raw SQL only.
+	LogPlaceholderStyle bool
+	// QueryIDFunc, when set, computes a query_id field from the SQL, e.g. to
+	// correlate entries with the database statistics (pg_stat_statements,
+	// performance_schema, ...). No field is added when it returns "".
+	QueryIDFunc func(sql string) string
+	// ConnWaitFromContext, when set, returns the time the query waited for a
+	// connection, as measured by the application. It is logged as conn_wait,
+	// along with db_time, the elapsed time minus conn_wait.
+	ConnWaitFromContext func(ctx context.Context) (time.Duration, bool)
+	// ConnAcquiredFromContext, when set, returns the time the query got its
+	// connection from the pool, as recorded by the application. It is
+	// logged as conn_acquired_at, to reconstruct the pool timing along with
+	// begin and elapsed.
+	ConnAcquiredFromContext func(ctx context.Context) (time.Time, bool)
+	// LockWaitFromContext, when set, returns the time the query waited for
+	// locks, as measured by the application. It is logged as lock_wait,
+	// along with lock_contended, true when it exceeds LockContendedThreshold,
+	// to tell lock contention from genuinely slow queries.
+	LockWaitFromContext    func(ctx context.Context) (time.Duration, bool)
+	LockContendedThreshold time.Duration
+	// ScannedRowsFromContext, when set, returns the number of rows the
+	// database scanned for the query, as measured by the application, since
+	// the logger only knows the returned rows. It is logged as rows_scanned,
+	// along with rows_returned.
+	ScannedRowsFromContext func(ctx context.Context) (int64, bool)
+	// ResultBytesFromContext, when set, returns the number of bytes the query
+	// returned, as measured by the application. It is logged as
+	// result_bytes, and queries returning more than LargeResultBytes, when
+	// positive, are logged at Warn level as EventLargeResult, to catch large
+	// payloads like big TEXT or BLOB columns even for a few rows.
+	ResultBytesFromContext func(ctx context.Context) (int64, bool)
+	LargeResultBytes       int64
+	// TempUsageFromContext, when set, returns the number of bytes of
+	// temporary files the query wrote, as reported by the database to the
+	// application. It is logged as temp_bytes, and queries writing more than
+	// LargeTempBytes, when positive, are logged at Warn level as
+	// EventLargeTempUsage, since spilling to disk usually means the query
+	// lacks memory.
+	TempUsageFromContext func(ctx context.Context) (int64, bool)
+	LargeTempBytes       int64
+	// SearchPathFromContext, when set, returns the Postgres search_path the
+	// query runs with, e.g. set by a tenant-routing layer with per-tenant
+	// schemas. It is logged as search_path.
+	SearchPathFromContext func(ctx context.Context) (string, bool)
+	// IndexHintFunc, when set, computes an index_hint field from the SQL,
+	// e.g. "seq_scan" or "index:idx_users_email" from cached EXPLAIN
+	// results. No field is added when it returns false.
+	IndexHintFunc func(ctx context.Context, sql string) (string, bool)
+	// CostFunc, when set, computes an estimated_cost field from the SQL,
+	// e.g. with a heuristic cost model. No field is added when it returns
+	// false.
+	CostFunc func(sql string) (float64, bool)
+	// QueryFields, SlowFields and ErrorFields, when set, add fields to the
+	// regular, slow and failed Trace entries respectively.
+	QueryFields TraceFieldsFn
+	SlowFields  TraceFieldsFn
+	ErrorFields TraceFieldsFn
+	// ConditionalFields add the Field of each rule whose When holds to the
+	// Trace entries, in order, before the fields of QueryFields, SlowFields
+	// and ErrorFields, e.g. a risky=true field for the DELETE statements
+	// affecting more than 1000 rows. The rules run for every entry, so they
+	// should be cheap. The rules with a nil When or Field are skipped.
+	ConditionalFields []ConditionalField
+	// OnSlowQuery, when set, is called for every query slower than
+	// SlowThreshold, failed or not, regardless of LogLevel. It runs
+	// synchronously in the query path, after the entry is logged.
+	OnSlowQuery func(ctx context.Context, sql string, rows int64, elapsed time.Duration)
+	// SlowQuerySampleRate, when greater than 1, samples the slow queries
+	// passed to OnSlowQuery to 1 in SlowQuerySampleRate, e.g. to protect
+	// the alerting during a widespread slowness, and also their entries
+	// with SampleSlowLog. Metrics still sees every slow query, and Stats
+	// counts the suppressed ones. Failed queries are always logged.
+	SlowQuerySampleRate int
+	SampleSlowLog       bool
+	// OnError, when set, is called for every failed query, regardless of
+	// LogLevel, unless the error is ignored by IgnoreRecordNotFoundError. It
+	// runs synchronously in the query path, after the entry is logged.
+	OnError func(ctx context.Context, sql string, err error)
+	// Metrics, when set, is called for every traced query, regardless of
+	// LogLevel, after the entry is logged.
+	Metrics func(ctx context.Context, info TraceInfo)
+	// KeepRecent, when positive, is the number of the last traced queries
+	// kept in memory, regardless of LogLevel, and returned by RecentQueries,
+	// e.g. for a debugging endpoint. Only their fingerprint is kept.
+	KeepRecent int
+	// IsPoolError, when set, reports whether an error of Trace is due to
+	// the connection pool being exhausted, e.g. DefaultIsPoolError. Such
+	// errors are logged at PoolErrorLevel with a pool_exhausted=true field,
+	// and OnPoolExhausted, when set, is called at most once per
+	// PoolExhaustedInterval for them, or for each of them when the interval
+	// is not positive.
+	IsPoolError           func(err error) bool
+	PoolErrorLevel        zapcore.Level
+	OnPoolExhausted       func(ctx context.Context, err error)
+	PoolExhaustedInterval time.Duration
+
+	shutdown   *int32
+	diagnosed  *int32
+	poolFired  *int64
+	slowStats  *slowQueryStats
+	recent     *recentQueries
+	errorsSeen *errorSignatures
+	catalog    *seenSet
+	routed     *routedLoggers
+	callers    *callerProbes
+	latency    *latencySummary
+	top        *topQueries
+	async      *asyncWriter
+	adaptive   *adaptiveThresholds
+	tee        gormlogger.Interface
 }
 
 func New(zapLogger *zap.Logger) Logger {
 	return Logger{
 		ZapLogger:                 zapLogger,
+		CoreFor:                   nil,
 		LogLevel:                  gormlogger.Warn,
 		SlowThreshold:             100 * time.Millisecond,
+		SlowQuietHours:            nil,
+		DiagnoseConfig:            false,
+		NearDeadlineMargin:        0,
 		SkipCallerLookup:          false,
+		SuppressCallerForPackages: nil,
+		CallerFormat:              CallerFormatFull,
+		CallerFormatFunc:          nil,
 		IgnoreRecordNotFoundError: false,
 		Context:                   nil,
+		RecoverContextFunc:        false,
+		GenerateCorrelationID:     false,
+		Version:                   "",
+		Host:                      "",
+		Port:                      0,
+		Enabled:                   nil,
+		NoLogMarker:               "",
+		ErrorField:                nil,
+		MaxAffectedRows:           0,
+		ExpectedMaxRows:           nil,
+		OperationLevels:           nil,
+		MinLogDuration:            0,
+		LogIfTraceSampled:         false,
+		TraceSampled:              nil,
+		WarnMissingWhere:          false,
+		LongTxnThreshold:          0,
+		LogInTransaction:          false,
+		LogEffectiveLevel:         false,
+		SeverityField:             false,
+		SeverityKey:               "",
+		SeverityNames:             nil,
+		ErrorLogOnce:              false,
+		CatalogMode:               false,
+		StructuredMessages:        false,
+		TrimMessage:               false,
+		TagGormInternal:           false,
+		AutoStructured:            false,
+		EncoderKind:               EncoderKindUnknown,
+		AsyncDropOnFull:           false,
+		OnLogDrop:                 nil,
+		Namespace:                 "",
+		DedupFields:               false,
+		QueryMessage:              defaultTraceMessage,
+		SlowMessage:               defaultTraceMessage,
+		ErrorMessage:              defaultTraceMessage,
+		EventField:                true,
+		Fields:                    FieldsDefault,
+		QueryMsgFn:                nil,
+		SlowMsgFn:                 nil,
+		ErrorMsgFn:                nil,
+		HybridMode:                false,
+		TagDDL:                    false,
+		StripSQLComments:          false,
+		CompactSQL:                false,
+		CompactMode:               false,
+		NormalizeKeywordCase:      false,
+		SQLFormatter:              nil,
+		TimeZone:                  nil,
+		LogQueryTime:              false,
+		LogBeginTime:              false,
+		SQLMode:                   SQLModeFull,
+		RowsMode:                  RowsModeAlways,
+		RowsFunc:                  nil,
+		LogSQLArgs:                false,
+		LogArgsOnError:            false,
+		VerboseSlow:               false,
+		PostErrorVerboseCount:     0,
+		MaskColumns:               nil,
+		RedactSQL:                 false,
+		Redactor:                  nil,
+		LogArgsSummary:            false,
+		LogParamsHash:             false,
+		InlineParamsForDebug:      false,
+		LogCallback:               false,
+		LogModel:                  false,
+		MaxArgsLength:             0,
+		LogParamCount:             false,
+		LogTableCount:             false,
+		LogPlaceholderStyle:       false,
+		QueryIDFunc:               nil,
+		ConnWaitFromContext:       nil,
+		ConnAcquiredFromContext:   nil,
+		LockWaitFromContext:       nil,
+		LockContendedThreshold:    0,
+		ScannedRowsFromContext:    nil,
+		ResultBytesFromContext:    nil,
+		LargeResultBytes:          0,
+		TempUsageFromContext:      nil,
+		LargeTempBytes:            0,
+		SearchPathFromContext:     nil,
+		IndexHintFunc:             nil,
+		CostFunc:                  nil,
+		QueryFields:               nil,
+		SlowFields:                nil,
+		ErrorFields:               nil,
+		ConditionalFields:         nil,
+		OnSlowQuery:               nil,
+		SlowQuerySampleRate:       0,
+		SampleSlowLog:             false,
+		OnError:                   nil,
+		Metrics:                   nil,
+		KeepRecent:                0,
+		IsPoolError:               nil,
+		PoolErrorLevel:            zapcore.WarnLevel,
+		OnPoolExhausted:           nil,
+		PoolExhaustedInterval:     time.Minute,
+		shutdown:                  new(int32),
+		diagnosed:                 new(int32),
+		poolFired:                 new(int64),
+		slowStats:                 &slowQueryStats{},
+		recent:                    &recentQueries{},
+		errorsSeen:                newErrorSignatures(defaultErrorSignatures),
+		catalog:                   newSeenSet(defaultCatalogFingerprints),
+		routed:                    &routedLoggers{},
+		callers:                   &callerProbes{},
 	}
 }
 
@@ -40,54 +579,1026 @@ func (l Logger) SetAsDefault() {
 	gormlogger.Default = l
 }
 
+// ShutdownMode makes the logger, and all the loggers derived from it, log
+// errors at debug level and stop flagging slow queries, so that the
+// cancellations and closed connections of a graceful shutdown do not page
+// anyone. It is meant to be called once from shutdown handlers, and
+// requires a logger made with New.
+func (l Logger) ShutdownMode() {
+	if l.shutdown != nil {
+		atomic.StoreInt32(l.shutdown, 1)
+	}
+}
+
+func (l Logger) shuttingDown() bool {
+	return l.shutdown != nil && atomic.LoadInt32(l.shutdown) == 1
+}
+
+// Close stops the background goroutines started by the logger options,
+// after writing the entries queued by WithAsyncWriter. With WithAsyncWriter,
+// it then syncs the zap logger and returns the error of Sync.
+func (l Logger) Close() error {
+	if l.latency != nil {
+		l.latency.stop()
+	}
+	if l.top != nil {
+		l.top.stop()
+	}
+	if l.async != nil {
+		l.async.close()
+		return l.ZapLogger.Sync()
+	}
+	return nil
+}
+
 func (l Logger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
-	return Logger{
-		ZapLogger:                 l.ZapLogger,
-		SlowThreshold:             l.SlowThreshold,
-		LogLevel:                  level,
-		SkipCallerLookup:          l.SkipCallerLookup,
-		IgnoreRecordNotFoundError: l.IgnoreRecordNotFoundError,
-		Context:                   l.Context,
+	newLogger := l
+	newLogger.LogLevel = level
+	if l.tee != nil {
+		newLogger.tee = l.tee.LogMode(level)
 	}
+	return newLogger
+}
+
+// Tee returns a copy of the logger that also forwards every Info, Warn, Error
+// and Trace call to other, e.g. to run a legacy logger side by side while
+// migrating. Every entry is then built and written twice, and Trace calls the
+// SQL callback once per logger.
+func (l Logger) Tee(other gormlogger.Interface) Logger {
+	l.tee = other
+	return l
+}
+
+// Named returns a copy of the logger whose zap.Logger is named after name,
+// appended to its current name, e.g. to attach to a gorm.Session dedicated
+// to a subsystem.
+func (l Logger) Named(name string) Logger {
+	l.ZapLogger = l.ZapLogger.Named(name)
+	return l
+}
+
+// AddCore returns a copy of the logger also writing its entries to core, e.g.
+// a compliance sink for GORM logs only. The zap.Logger the logger was built
+// with and the loggers sharing it are not affected.
+func (l Logger) AddCore(core zapcore.Core) Logger {
+	l.ZapLogger = l.ZapLogger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(c, core)
+	}))
+	return l
 }
 
 func (l Logger) Info(ctx context.Context, str string, args ...interface{}) {
-	if l.LogLevel < gormlogger.Info {
+	if l.tee != nil {
+		l.tee.Info(ctx, str, args...)
+	}
+	if l.LogLevel < gormlogger.Info || !l.enabled(ctx) {
 		return
 	}
-	l.logger(ctx).Sugar().Debugf(str, args...)
+	if l.structuredMessages() {
+		l.logger(ctx, zapcore.DebugLevel, l.caller(), l.structuredMessageFields(str, args)...).Debug("info")
+		return
+	}
+	str, args = l.trimMessage(str, args)
+	l.logger(ctx, zapcore.DebugLevel, l.caller()).Sugar().Debugf(str, args...)
 }
 
 func (l Logger) Warn(ctx context.Context, str string, args ...interface{}) {
-	if l.LogLevel < gormlogger.Warn {
+	if l.tee != nil {
+		l.tee.Warn(ctx, str, args...)
+	}
+	if l.LogLevel < gormlogger.Warn || !l.enabled(ctx) {
+		return
+	}
+	var fields []zapcore.Field
+	if l.TagGormInternal {
+		fields = append(fields, zap.Bool("gorm_internal", true))
+	}
+	if l.structuredMessages() {
+		fields = append(fields, l.structuredMessageFields(str, args)...)
+	}
+	logger := l.logger(ctx, zapcore.WarnLevel, l.caller(), fields...)
+	if l.structuredMessages() {
+		logger.Warn("warn")
 		return
 	}
-	l.logger(ctx).Sugar().Warnf(str, args...)
+	str, args = l.trimMessage(str, args)
+	logger.Sugar().Warnf(str, args...)
 }
 
 func (l Logger) Error(ctx context.Context, str string, args ...interface{}) {
-	if l.LogLevel < gormlogger.Error {
+	if l.tee != nil {
+		l.tee.Error(ctx, str, args...)
+	}
+	if l.LogLevel < gormlogger.Error || !l.enabled(ctx) {
 		return
 	}
-	l.logger(ctx).Sugar().Errorf(str, args...)
+	level := zapcore.ErrorLevel
+	if l.shuttingDown() {
+		level = zapcore.DebugLevel
+	}
+	var fields []zapcore.Field
+	if l.structuredMessages() {
+		fields = l.structuredMessageFields(str, args)
+	}
+	logger := l.logger(ctx, level, l.caller(), fields...)
+	switch {
+	case l.structuredMessages() && l.shuttingDown():
+		logger.Debug("error")
+	case l.structuredMessages():
+		logger.Error("error")
+	case l.shuttingDown():
+		str, args = l.trimMessage(str, args)
+		logger.Sugar().Debugf(str, args...)
+	default:
+		str, args = l.trimMessage(str, args)
+		logger.Sugar().Errorf(str, args...)
+	}
+}
+
+// trimMessage formats and trims the message of str and args with
+// TrimMessage, returning it without args.
+func (l Logger) trimMessage(str string, args []interface{}) (string, []interface{}) {
+	if !l.TrimMessage {
+		return str, args
+	}
+	if len(args) > 0 {
+		str = fmt.Sprintf(str, args...)
+	}
+	return strings.TrimRightFunc(str, unicode.IsSpace), nil
+}
+
+func (l Logger) structuredMessageFields(str string, args []interface{}) []zapcore.Field {
+	return []zapcore.Field{zap.String("gorm_msg", str), zap.Any("args", args)}
+}
+
+// namespaced nests fields under Namespace, if any.
+func (l Logger) namespaced(fields []zapcore.Field) []zapcore.Field {
+	if l.Namespace == "" || len(fields) == 0 {
+		return fields
+	}
+	return append([]zapcore.Field{zap.Namespace(l.Namespace)}, fields...)
 }
 
+// Trace logs a query executed by GORM. The fields of its entries are in a
+// deterministic order: the fields of Context, correlation_id, app_version,
+// db_host, db_port and severity, then sql or sql_hash, rows, elapsed, the
+// caller field with a CallerFormat other than CallerFormatFull, error and
+// gorm_event, the fields of the optional features in a fixed order, and
+// last the fields of QueryFields, SlowFields or ErrorFields and
+// effective_level. Namespace nests all the fields following the ones of
+// Context.
 func (l Logger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
-	if l.LogLevel <= 0 {
+	if l.tee != nil {
+		l.tee.Trace(ctx, begin, fc, err)
+	}
+	elapsed := time.Since(begin)
+	if l.latency != nil {
+		l.latency.add(elapsed)
+	}
+	d := l.newTraceDecision(ctx, begin, elapsed, fc, err)
+	if l.PostErrorVerboseCount > 0 {
+		d.query.afterError = afterRequestError(ctx, d.fail, l.PostErrorVerboseCount)
+	}
+	if l.adaptive != nil {
+		l.adaptive.observe(d.query.fingerprint(), elapsed)
+	}
+	if l.top != nil {
+		l.top.add(d.query.fingerprint(), l.SQLMode == SQLModeHashOnly, elapsed)
+	}
+	if l.KeepRecent > 0 && l.recent != nil {
+		l.recent.add(l.KeepRecent, RecentQuery{Begin: begin, Fingerprint: d.query.fingerprint(), Elapsed: elapsed, Err: err})
+	}
+	if l.DiagnoseConfig && d.threshold > 0 {
+		l.diagnoseDeadline(ctx, begin, d.threshold)
+	}
+	d.sampled = !d.slow || l.sampleSlowQuery()
+	l.decideTrace(ctx, begin, elapsed, &d)
+	errorOnce := d.event == EventError && l.ErrorLogOnce && l.errorsSeen != nil
+	if errorOnce && l.errorsSeen.contains(err) {
+		d.event = ""
+	}
+	slowHook := d.slow && d.sampled && !d.quiet && l.OnSlowQuery != nil
+	if d.event == "" && l.Metrics == nil && !slowHook && !(d.fail && l.OnError != nil) && !(d.pool && l.OnPoolExhausted != nil) {
 		return
 	}
+	catalog := d.event != "" && d.event != EventError && l.CatalogMode && l.catalog != nil
+	if catalog {
+		d.query.catalogued = l.catalog.contains(d.query.fingerprint())
+	}
+
+	caller := callerInfo{suppressed: true}
+	if l.Fields.Has(FieldCaller) {
+		caller = l.caller()
+	}
+	info := l.decisionInfo(begin, elapsed, &d, err, caller)
+	sql, rows := info.SQL, info.Rows
+	if d.event != "" {
+		msg, fields := l.traceEntry(ctx, &d, info)
+		logger, fields := l.traceLogger(ctx, d.level, caller, fields)
+		if ce := logger.Check(d.level, msg); ce != nil {
+			ce.Write(fields...)
+			// Only the fingerprints and errors actually logged are recorded.
+			if catalog && !d.query.catalogued {
+				l.catalog.repeated(d.query.fingerprint())
+			}
+			if errorOnce {
+				l.errorsSeen.repeated(err)
+			}
+		}
+	}
+	if slowHook {
+		l.OnSlowQuery(ctx, sql, rows, elapsed)
+	}
+	if d.fail && l.OnError != nil {
+		l.OnError(ctx, sql, err)
+	}
+	if d.pool && l.OnPoolExhausted != nil && l.poolExhaustedDue() {
+		l.OnPoolExhausted(ctx, err)
+	}
+	if l.Metrics != nil {
+		l.Metrics(ctx, info)
+	}
+}
+
+// RenderTrace returns the level, message and fields of the entry Trace
+// would log for a query, context and caller fields included, without
+// logging it, e.g. to preview the output of a configuration. It has no side
+// effect: it ignores the callbacks, WithLatencySummary, WithTopQueries and
+// the like, considers slow queries sampled with SlowQuerySampleRate, and
+// neither records the fingerprints of CatalogMode nor the errors of
+// ErrorLogOnce. Like TraceFields, it uses a background context. The
+// message is empty, with no fields, when Trace would log nothing.
+func (l Logger) RenderTrace(begin time.Time, fc func() (string, int64), err error) (zapcore.Level, string, []zapcore.Field) {
+	ctx := context.Background()
 	elapsed := time.Since(begin)
-	logger := l.logger(ctx)
+	d := l.newTraceDecision(ctx, begin, elapsed, fc, err)
+	d.sampled = true
+	l.decideTrace(ctx, begin, elapsed, &d)
+	if d.event == EventError && l.ErrorLogOnce && l.errorsSeen != nil && l.errorsSeen.contains(err) {
+		d.event = ""
+	}
+	if d.event == "" || !l.routedLogger(ctx, d.level).Core().Enabled(d.level) {
+		return d.level, "", nil
+	}
+	if d.event != EventError && l.CatalogMode && l.catalog != nil {
+		d.query.catalogued = l.catalog.contains(d.query.fingerprint())
+	}
+
+	caller := callerInfo{suppressed: true}
+	if l.Fields.Has(FieldCaller) {
+		caller = l.caller()
+	}
+	msg, fields := l.traceEntry(ctx, &d, l.decisionInfo(begin, elapsed, &d, err, caller))
+	return d.level, msg, l.entryFields(ctx, d.level, fields)
+}
+
+// traceDecision is what Trace and RenderTrace determine about a query: its
+// classification, and the level and event of its entry, if any.
+type traceDecision struct {
+	query     tracedQuery
+	threshold time.Duration
+	slow      bool
+	fail      bool
+	near      bool
+	pool      bool
+	txn       time.Duration
+	longTxn   bool
+	inTxn     bool
+	sampled   bool // set by the caller, see sampleSlowQuery
+	quiet     bool
+
+	level zapcore.Level
+	event string
+}
+
+func (l Logger) newTraceDecision(ctx context.Context, begin time.Time, elapsed time.Duration, fc func() (string, int64), err error) traceDecision {
+	d := traceDecision{query: l.newTracedQuery(fc)}
+	d.query.logCaller = (l.CallerFormat != CallerFormatFull || l.CallerFormatFunc != nil) && l.zapAddsCaller()
+	d.threshold = l.slowThreshold(&d.query)
+	d.slow = d.threshold > 0 && elapsed > d.threshold && !l.shuttingDown()
+	d.fail = l.isReportedError(err)
+	d.near = l.isNearDeadline(ctx, begin, elapsed)
+	d.pool = d.fail && l.IsPoolError != nil && l.IsPoolError(err)
+	if l.LongTxnThreshold > 0 || l.LogInTransaction {
+		txn, ended := transactionDuration(ctx, &d.query, begin, elapsed)
+		if ended && l.LongTxnThreshold > 0 && txn > l.LongTxnThreshold {
+			d.txn, d.longTxn = txn, true
+		}
+		d.inTxn = ended || isInTransaction(ctx)
+	}
+	return d
+}
+
+// decideTrace sets the level and event of the entry of d, leaving the event
+// empty when the query is not logged.
+func (l Logger) decideTrace(ctx context.Context, begin time.Time, elapsed time.Duration, d *traceDecision) {
+	d.quiet = d.slow && len(l.SlowQuietHours) > 0 && l.inSlowQuietHours(begin)
 	switch {
-	case err != nil && l.LogLevel >= gormlogger.Error && (!l.IgnoreRecordNotFoundError || !errors.Is(err, gorm.ErrRecordNotFound)):
-		sql, rows := fc()
-		logger.Error("trace", zap.Error(err), zap.Duration("elapsed", elapsed), zap.Int64("rows", rows), zap.String("sql", sql))
-	case l.SlowThreshold != 0 && elapsed > l.SlowThreshold && l.LogLevel >= gormlogger.Warn:
-		sql, rows := fc()
-		logger.Warn("trace", zap.Duration("elapsed", elapsed), zap.Int64("rows", rows), zap.String("sql", sql))
-	case l.LogLevel >= gormlogger.Info:
-		sql, rows := fc()
-		logger.Debug("trace", zap.Duration("elapsed", elapsed), zap.Int64("rows", rows), zap.String("sql", sql))
+	case !l.enabled(ctx):
+	case d.fail && l.LogLevel >= gormlogger.Error:
+		d.level, d.event = zapcore.ErrorLevel, EventError
+		if d.pool {
+			d.level = l.PoolErrorLevel
+		}
+		if l.shuttingDown() {
+			d.level = zapcore.DebugLevel
+		}
+	case d.longTxn && l.LogLevel >= gormlogger.Warn:
+		d.level, d.event = zapcore.WarnLevel, EventLongTransaction
+	case l.WarnMissingWhere && l.LogLevel >= gormlogger.Warn && isMissingWhere(&d.query):
+		d.level, d.event = zapcore.WarnLevel, EventMissingWhere
+	case d.slow && l.LogLevel >= gormlogger.Warn && (d.sampled || !l.SampleSlowLog):
+		d.level, d.event = zapcore.WarnLevel, EventSlowQuery
+		if d.quiet {
+			d.level = zapcore.InfoLevel
+		}
+	case l.MaxAffectedRows > 0 && l.LogLevel >= gormlogger.Warn && l.isLargeWrite(d.query.get()):
+		d.level, d.event = zapcore.WarnLevel, EventLargeWrite
+	case len(l.ExpectedMaxRows) > 0 && l.LogLevel >= gormlogger.Warn && l.hasTooManyRows(&d.query):
+		d.level, d.event = zapcore.WarnLevel, EventTooManyRows
+	case l.LargeResultBytes > 0 && l.LogLevel >= gormlogger.Warn && l.hasLargeResult(ctx):
+		d.level, d.event = zapcore.WarnLevel, EventLargeResult
+	case l.LargeTempBytes > 0 && l.LogLevel >= gormlogger.Warn && l.hasLargeTempUsage(ctx):
+		d.level, d.event = zapcore.WarnLevel, EventLargeTempUsage
+	case d.near && l.LogLevel >= gormlogger.Warn:
+		d.level, d.event = zapcore.WarnLevel, EventQuery
+	case d.query.afterError && l.LogLevel >= gormlogger.Error:
+		d.level, d.event = zapcore.InfoLevel, EventQuery
+	case l.LogLevel >= gormlogger.Info && elapsed >= l.MinLogDuration && l.isTraceSampled(ctx):
+		d.level, d.event = zapcore.DebugLevel, EventQuery
+		if len(l.OperationLevels) > 0 {
+			if operationLevel, ok := l.OperationLevels[d.query.verb()]; ok {
+				d.level = operationLevel
+			}
+		}
+	}
+	if d.event != "" && d.event != EventError && l.hasNoLogMarker(&d.query) {
+		d.event = ""
+	}
+}
+
+func (l Logger) decisionInfo(begin time.Time, elapsed time.Duration, d *traceDecision, err error, caller callerInfo) TraceInfo {
+	info := l.traceInfo(begin, elapsed, &d.query, err, d.slow, d.threshold, caller)
+	info.NearDeadline = d.near
+	info.PoolExhausted = d.pool
+	info.TransactionDuration = d.txn
+	info.InTransaction = d.inTxn
+	return info
+}
+
+// traceEntry returns the message and the fields of the entry of d, without
+// the context and caller fields.
+func (l Logger) traceEntry(ctx context.Context, d *traceDecision, info TraceInfo) (string, []zapcore.Field) {
+	msg, fields := l.traceMessage(d.event, info), []zapcore.Field(nil)
+	if l.HybridMode || l.traceMsgFn(d.event) == nil {
+		// Skip traceFields, traceEntry and Trace or RenderTrace.
+		fields = l.traceFields(ctx, d.event, info, &d.query, 3)
+		if l.LogEffectiveLevel {
+			fields = append(fields, zap.String("effective_level", d.level.String()))
+		}
+	}
+	return msg, fields
+}
+
+// TraceFields returns the fields Trace logs for a query, with the caller as
+// a caller field, for wrappers logging queries through their own paths. It
+// does not log anything nor call the callbacks, and ignores LogLevel,
+// Enabled and NoLogMarker: the queries Trace would not log get the fields of
+// a regular entry. Like RenderTrace, it uses a background context.
+func (l Logger) TraceFields(begin time.Time, fc func() (string, int64), err error) []zapcore.Field {
+	l.LogLevel, l.Enabled, l.NoLogMarker = gormlogger.Info, nil, ""
+	ctx := context.Background()
+	elapsed := time.Since(begin)
+	d := l.newTraceDecision(ctx, begin, elapsed, fc, err)
+	d.sampled = true
+	l.decideTrace(ctx, begin, elapsed, &d)
+	if d.event == "" {
+		d.event = EventQuery
+	}
+	caller := callerInfo{suppressed: true}
+	if l.Fields.Has(FieldCaller) {
+		caller = l.caller()
+	}
+	d.query.logCaller = true
+	// Skip traceFields and TraceFields.
+	return l.namespaced(l.traceFields(ctx, d.event, l.decisionInfo(begin, elapsed, &d, err, caller), &d.query, 2))
+}
+
+// logArgs reports whether the args field is logged for event.
+func (l Logger) logArgs(event string) bool {
+	return l.LogSQLArgs || l.LogArgsOnError && event == EventError || l.VerboseSlow && event == EventSlowQuery
+}
+
+func (l Logger) traceInfo(begin time.Time, elapsed time.Duration, query *tracedQuery, err error, slow bool, threshold time.Duration, caller callerInfo) TraceInfo {
+	sql, rows := query.get()
+	return TraceInfo{
+		Begin:         l.inTimeZone(begin),
+		Elapsed:       elapsed,
+		SQL:           sql,
+		Rows:          rows,
+		Operation:     query.verb(),
+		Err:           err,
+		Slow:          slow,
+		SlowThreshold: threshold,
+		Caller:        l.formatCaller(caller),
+	}
+}
+
+// isTraceSampled reports whether the regular entries of ctx are logged with
+// LogIfTraceSampled.
+func (l Logger) isTraceSampled(ctx context.Context) bool {
+	if !l.LogIfTraceSampled || l.TraceSampled == nil || ctx == nil {
+		return true
+	}
+	sampled, ok := l.TraceSampled(ctx)
+	return sampled || !ok
+}
+
+// isNearDeadline reports whether a query started at begin ended within
+// NearDeadlineMargin of the deadline of ctx.
+func (l Logger) isNearDeadline(ctx context.Context, begin time.Time, elapsed time.Duration) bool {
+	if l.NearDeadlineMargin <= 0 || ctx == nil {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && elapsed > deadline.Sub(begin)-l.NearDeadlineMargin
+}
+
+// diagnoseDeadline logs, once per logger returned by New, that threshold
+// cannot be reached by queries with the deadline of ctx. Like Trace, it logs
+// nothing with Enabled or ContextSilenced.
+func (l Logger) diagnoseDeadline(ctx context.Context, begin time.Time, threshold time.Duration) {
+	if ctx == nil || !l.enabled(ctx) || l.diagnosed == nil || atomic.LoadInt32(l.diagnosed) == 1 {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok || deadline.Sub(begin) >= threshold || !atomic.CompareAndSwapInt32(l.diagnosed, 0, 1) {
+		return
+	}
+	l.logger(ctx, zapcore.DebugLevel, l.caller(),
+		zap.Duration("slow_threshold", threshold),
+		zap.Duration("deadline", deadline.Sub(begin)),
+	).Debug("slow threshold exceeds context deadline")
+}
+
+// tracedQuery calls the SQL callback given to Trace at most once.
+type tracedQuery struct {
+	fc            func() (string, int64)
+	stripComments bool
+	compact       bool
+	mask          []string
+	redactor      Redactor
+	normalizeCase bool
+	catalogued    bool // the fingerprint was already logged with CatalogMode
+	afterError    bool // logged verbosely with PostErrorVerboseCount
+	logCaller     bool // the caller is a field of the entry, not zap's
+	done          bool
+	raw           string
+	sql           string
+	rows          int64
+
+	fingerprinted bool
+	fp            string
+
+	verbParsed bool
+	sqlVerb    string
+}
+
+func (l Logger) newTracedQuery(fc func() (string, int64)) tracedQuery {
+	q := tracedQuery{
+		fc:            fc,
+		stripComments: l.StripSQLComments,
+		compact:       l.CompactSQL,
+		mask:          l.MaskColumns,
+		normalizeCase: l.NormalizeKeywordCase,
+	}
+	if l.RedactSQL {
+		q.redactor = l.Redactor
+		if q.redactor == nil {
+			q.redactor = DefaultRedactor
+		}
+	}
+	return q
+}
+
+func (q *tracedQuery) get() (string, int64) {
+	if !q.done {
+		q.raw, q.rows = q.fc()
+		q.sql = q.raw
+		if q.stripComments {
+			q.sql = stripSQLComments(q.sql)
+		}
+		if q.compact {
+			q.sql = compactSQL(q.sql)
+		}
+		if len(q.mask) > 0 {
+			q.sql = maskSQL(q.sql, q.mask)
+		}
+		if q.redactor != nil {
+			q.sql = q.redactor.Redact(q.sql)
+		}
+		q.done = true
+	}
+	return q.sql, q.rows
+}
+
+// rawSQL returns the SQL as given by GORM, before any rewriting.
+func (q *tracedQuery) rawSQL() string {
+	q.get()
+	return q.raw
+}
+
+func (q *tracedQuery) fingerprint() string {
+	if !q.fingerprinted {
+		sql, _ := q.get()
+		q.fp = Fingerprint(sql)
+		if q.normalizeCase {
+			q.fp = normalizeKeywordCase(q.fp)
+		}
+		q.fingerprinted = true
+	}
+	return q.fp
+}
+
+func (q *tracedQuery) verb() string {
+	if !q.verbParsed {
+		sql, _ := q.get()
+		q.sqlVerb = sqlVerb(sql)
+		q.verbParsed = true
+	}
+	return q.sqlVerb
+}
+
+// traceFields returns the fields of a Trace entry. With VerboseSlow, the
+// stack of slow queries skips the stackSkip innermost frames, which belong
+// to the logger.
+func (l Logger) traceFields(ctx context.Context, event string, info TraceInfo, query *tracedQuery, stackSkip int) []zapcore.Field {
+	logCaller := query.logCaller && info.Caller != ""
+	if l.CompactMode {
+		fields := []zapcore.Field{compactField(event, info, query)}
+		if logCaller {
+			fields = append(fields, zap.String("caller", info.Caller))
+		}
+		return fields
+	}
+	fields := make([]zapcore.Field, 0, 6)
+	if l.Fields.Has(FieldSQL) {
+		if !query.catalogued || event == EventError || l.SQLMode == SQLModeHashOnly {
+			fields = append(fields, l.sqlField(info.SQL))
+		}
+		if l.CatalogMode && l.SQLMode != SQLModeHashOnly {
+			fields = append(fields, zap.String("fingerprint", query.fingerprint()))
+		}
+	}
+	if l.Fields.Has(FieldRows) && l.logRows(ctx, info.SQL) {
+		fields = append(fields, zap.Int64("rows", info.Rows))
+	}
+	if l.Fields.Has(FieldElapsed) {
+		fields = append(fields, zap.Duration("elapsed", info.Elapsed))
+	}
+	if logCaller {
+		fields = append(fields, zap.String("caller", info.Caller))
+	}
+	if event == EventError && l.Fields.Has(FieldError) {
+		fields = append(fields, l.errorField(info.Err))
+	}
+	if l.EventField && l.Fields.Has(FieldEvent) {
+		fields = append(fields, zap.String("gorm_event", event))
+	}
+	if isMigrationContext(ctx) || l.TagDDL && isDDL(info.SQL) {
+		fields = append(fields, zap.Bool("migration", true))
+	}
+	if attempt, ok := AttemptFromContext(ctx); ok {
+		fields = append(fields, zap.Int("attempt", attempt))
+	}
+	if l.LogCallback || l.Fields.Has(FieldCallback) {
+		if callback := callbackFromContext(ctx); callback != "" {
+			fields = append(fields, zap.String("callback", callback))
+		}
+	}
+	if l.LogModel {
+		if model := modelFromContext(ctx); model != "" {
+			fields = append(fields, zap.String("model", model))
+		}
+	}
+	if info.NearDeadline {
+		fields = append(fields, zap.Bool("near_deadline", true))
+	}
+	if info.PoolExhausted {
+		fields = append(fields, zap.Bool("pool_exhausted", true))
+	}
+	if info.TransactionDuration > 0 {
+		fields = append(fields, zap.Duration("txn_duration", info.TransactionDuration))
+	}
+	if l.LogInTransaction {
+		fields = append(fields, zap.Bool("in_transaction", info.InTransaction))
+	}
+	if l.VerboseSlow && event == EventSlowQuery {
+		fields = append(fields, zap.StackSkip("stack", stackSkip))
+	}
+	if event == EventTooManyRows {
+		fields = append(fields, zap.Int64("expected_max_rows", l.ExpectedMaxRows[query.fingerprint()]))
+	}
+	if l.LogQueryTime || l.Fields.Has(FieldQueryTime) {
+		fields = append(fields, zap.Time("query_time", info.Begin))
+	}
+	if l.LogBeginTime || l.Fields.Has(FieldBeginTime) {
+		fields = append(fields, zap.Time("begin", info.Begin))
+	}
+	if l.LogParamCount || l.Fields.Has(FieldParamCount) {
+		fields = append(fields, zap.Int("param_count", countPlaceholders(query.fingerprint())))
+	}
+	if l.LogTableCount {
+		fields = append(fields, zap.Int("table_count", tableCount(query.fingerprint())))
+	}
+	if l.LogPlaceholderStyle || l.Fields.Has(FieldPlaceholderStyle) {
+		fields = append(fields, zap.String("placeholder_style", placeholderStyle(info.SQL)))
+	}
+	if l.QueryIDFunc != nil {
+		if id := l.QueryIDFunc(info.SQL); id != "" {
+			fields = append(fields, zap.String("query_id", id))
+		}
+	}
+	if l.ConnWaitFromContext != nil {
+		if wait, ok := l.ConnWaitFromContext(ctx); ok {
+			fields = append(fields, zap.Duration("conn_wait", wait), zap.Duration("db_time", info.Elapsed-wait))
+		}
+	}
+	if l.ConnAcquiredFromContext != nil {
+		if acquired, ok := l.ConnAcquiredFromContext(ctx); ok {
+			fields = append(fields, zap.Time("conn_acquired_at", l.inTimeZone(acquired)))
+		}
+	}
+	if l.LockWaitFromContext != nil {
+		if wait, ok := l.LockWaitFromContext(ctx); ok {
+			fields = append(fields, zap.Duration("lock_wait", wait), zap.Bool("lock_contended", wait > l.LockContendedThreshold))
+		}
+	}
+	if l.ScannedRowsFromContext != nil {
+		if scanned, ok := l.ScannedRowsFromContext(ctx); ok {
+			fields = append(fields, zap.Int64("rows_scanned", scanned), zap.Int64("rows_returned", info.Rows))
+		}
+	}
+	if l.ResultBytesFromContext != nil {
+		if n, ok := l.ResultBytesFromContext(ctx); ok {
+			fields = append(fields, zap.Int64("result_bytes", n))
+		}
+	}
+	if l.TempUsageFromContext != nil {
+		if n, ok := l.TempUsageFromContext(ctx); ok {
+			fields = append(fields, zap.Int64("temp_bytes", n))
+		}
+	}
+	if l.SearchPathFromContext != nil {
+		if sp, ok := l.SearchPathFromContext(ctx); ok {
+			fields = append(fields, zap.String("search_path", sp))
+		}
+	}
+	if l.IndexHintFunc != nil {
+		if hint, ok := l.IndexHintFunc(ctx, info.SQL); ok {
+			fields = append(fields, zap.String("index_hint", hint))
+		}
+	}
+	if l.CostFunc != nil {
+		if cost, ok := l.CostFunc(info.SQL); ok {
+			fields = append(fields, zap.Float64("estimated_cost", cost))
+		}
+	}
+	if query.afterError {
+		fields = append(fields, zap.Bool("post_error", true))
+	}
+	logArgs := l.logArgs(event) || query.afterError
+	if logArgs || l.LogArgsSummary || l.LogParamsHash || l.InlineParamsForDebug {
+		if args, ok := sqlArgs(ctx); ok {
+			stmtSQL := statementFromContext(ctx).SQL.String()
+			if len(l.MaskColumns) > 0 {
+				args = maskArgs(stmtSQL, args, l.MaskColumns)
+			}
+			if logArgs {
+				fields = append(fields, l.argsFields(args)...)
+			}
+			if l.LogArgsSummary {
+				fields = append(fields, zap.String("args_summary", argsSummary(args)))
+			}
+			if l.LogParamsHash {
+				fields = append(fields, zap.String("params_hash", paramsHash(args)))
+			}
+			if l.InlineParamsForDebug && l.SQLMode != SQLModeHashOnly {
+				inlined := inlineSQL(stmtSQL, args)
+				if query.redactor != nil {
+					inlined = query.redactor.Redact(inlined)
+				}
+				fields = append(fields, zap.String("sql_inlined", inlined))
+			}
+		}
+	}
+	for _, rule := range l.ConditionalFields {
+		if rule.When != nil && rule.Field != nil && rule.When(info) {
+			fields = append(fields, rule.Field(info))
+		}
+	}
+	if fn := l.traceFieldsFn(event); fn != nil {
+		fields = append(fields, fn(ctx, info.SQL, info.Rows, info.Elapsed, info.Caller, info.Err)...)
+	}
+	return fields
+}
+
+func (l Logger) errorField(err error) zapcore.Field {
+	if l.ErrorField != nil {
+		return l.ErrorField(err)
+	}
+	return zap.Error(err)
+}
+
+// compactField returns the q field of CompactMode.
+func compactField(event string, info TraceInfo, query *tracedQuery) zapcore.Field {
+	op := strings.ToLower(query.verb())
+	if op == "" {
+		op = "unknown"
+	}
+	var b strings.Builder
+	b.Grow(48)
+	b.WriteString("op=")
+	b.WriteString(op)
+	b.WriteString(" rows=")
+	b.WriteString(strconv.FormatInt(info.Rows, 10))
+	b.WriteString(" elapsed=")
+	b.WriteString(info.Elapsed.String())
+	if event != EventQuery {
+		b.WriteString(" event=")
+		b.WriteString(event)
+	}
+	if event == EventError && info.Err != nil {
+		b.WriteString(" error=")
+		b.WriteString(info.Err.Error())
+	}
+	return zap.String("q", b.String())
+}
+
+func (l Logger) traceFieldsFn(event string) TraceFieldsFn {
+	switch event {
+	case EventLargeWrite, EventMissingWhere, EventLongTransaction, EventTooManyRows, EventLargeResult, EventLargeTempUsage:
+		return nil
+	case EventError:
+		return l.ErrorFields
+	case EventSlowQuery:
+		return l.SlowFields
+	default:
+		return l.QueryFields
+	}
+}
+
+const defaultCatalogFingerprints = 10000
+
+// SQLMode is the way the SQL of Trace entries is logged.
+type SQLMode int
+
+const (
+	// SQLModeFull logs the SQL as a sql field.
+	SQLModeFull SQLMode = iota
+	// SQLModeHashOnly logs no SQL text at all, only a sql_hash field set to
+	// SQLHash of the statement, for correlation with a query catalog.
+	SQLModeHashOnly
+)
+
+// RowsMode is the way the rows of Trace entries are logged.
+type RowsMode int
+
+const (
+	// RowsModeAlways logs the rows field of every Trace entry.
+	RowsModeAlways RowsMode = iota
+	// RowsModeSkipRaw omits the rows field of the queries run with a context
+	// returned by ContextForRawSQL, whose row counts are often meaningless.
+	RowsModeSkipRaw
+)
+
+func (l Logger) logRows(ctx context.Context, sql string) bool {
+	if l.RowsFunc != nil {
+		return l.RowsFunc(ctx, sql)
+	}
+	return l.RowsMode != RowsModeSkipRaw || !isRawSQLContext(ctx)
+}
+
+func (l Logger) sqlField(sql string) zapcore.Field {
+	if l.SQLMode == SQLModeHashOnly {
+		if l.NormalizeKeywordCase {
+			return zap.String("sql_hash", fingerprintHash(normalizeKeywordCase(Fingerprint(sql))))
+		}
+		return zap.String("sql_hash", SQLHash(sql))
+	}
+	if l.SQLFormatter != nil {
+		sql = l.SQLFormatter(sql)
+	}
+	return zap.String("sql", sql)
+}
+
+func (l Logger) inTimeZone(t time.Time) time.Time {
+	if l.TimeZone == nil {
+		return t
+	}
+	return t.In(l.TimeZone)
+}
+
+// TraceInfo describes a query traced by Logger.Trace.
+type TraceInfo struct {
+	Begin   time.Time
+	Elapsed time.Duration
+	SQL     string
+	Rows    int64
+	// Operation is the first keyword of SQL, upper-cased, e.g. SELECT.
+	Operation string
+	Err       error
+	// Slow reports whether Elapsed exceeds SlowThreshold, the threshold
+	// that applied to the query.
+	Slow          bool
+	SlowThreshold time.Duration
+	// Caller is the file:line that issued the query, rendered according to
+	// CallerFormat, or an empty string when SkipCallerLookup is set.
+	Caller string
+	// NearDeadline reports whether the query ended within NearDeadlineMargin
+	// of the deadline of its context.
+	NearDeadline bool
+	// PoolExhausted reports whether Err is a pool error, see IsPoolError.
+	PoolExhausted bool
+	// TransactionDuration is the duration of the transaction ended by the
+	// query when it exceeds LongTxnThreshold, or 0.
+	TransactionDuration time.Duration
+	// InTransaction reports whether the query ran in a transaction, with
+	// LogInTransaction.
+	InTransaction bool
+}
+
+// enabled reports whether the logger writes entries for ctx, according to
+// Enabled and ContextSilenced.
+func (l Logger) enabled(ctx context.Context) bool {
+	return (l.Enabled == nil || l.Enabled()) && !isSilencedContext(ctx)
+}
+
+// isReportedError reports whether err is an error Trace should report, i.e.
+// not nil nor ignored by IgnoreRecordNotFoundError.
+func (l Logger) isReportedError(err error) bool {
+	return err != nil && (!l.IgnoreRecordNotFoundError || !errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+// hasNoLogMarker reports whether the query contains NoLogMarker.
+func (l Logger) hasNoLogMarker(query *tracedQuery) bool {
+	if l.NoLogMarker == "" {
+		return false
+	}
+	return strings.Contains(query.rawSQL(), l.NoLogMarker)
+}
+
+// isLargeWrite reports whether sql is an UPDATE or DELETE which affected
+// more than MaxAffectedRows rows.
+func (l Logger) isLargeWrite(sql string, rows int64) bool {
+	if rows <= l.MaxAffectedRows {
+		return false
+	}
+	switch sqlVerb(sql) {
+	case "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
+
+// hasTooManyRows reports whether query has more rows than the
+// ExpectedMaxRows of its fingerprint.
+func (l Logger) hasTooManyRows(query *tracedQuery) bool {
+	limit, ok := l.ExpectedMaxRows[query.fingerprint()]
+	_, rows := query.get()
+	return ok && rows > limit
+}
+
+// hasLargeResult reports whether the query of ctx returned more than
+// LargeResultBytes bytes.
+func (l Logger) hasLargeResult(ctx context.Context) bool {
+	if l.ResultBytesFromContext == nil {
+		return false
+	}
+	n, ok := l.ResultBytesFromContext(ctx)
+	return ok && n > l.LargeResultBytes
+}
+
+// hasLargeTempUsage reports whether the query of ctx wrote more than
+// LargeTempBytes bytes of temporary files.
+func (l Logger) hasLargeTempUsage(ctx context.Context) bool {
+	if l.TempUsageFromContext == nil {
+		return false
+	}
+	n, ok := l.TempUsageFromContext(ctx)
+	return ok && n > l.LargeTempBytes
+}
+
+// slowThreshold returns the elapsed time above which query is slow. Slow
+// query detection is disabled when it is not strictly positive.
+func (l Logger) slowThreshold(query *tracedQuery) time.Duration {
+	if l.adaptive != nil {
+		if threshold, ok := l.adaptive.threshold(query.fingerprint()); ok {
+			return threshold
+		}
+	}
+	return l.SlowThreshold
+}
+
+// Values of the gorm_event field, one per Trace branch.
+const (
+	EventQuery     = "query"
+	EventSlowQuery = "slow_query"
+	EventError     = "error"
+	// EventLargeWrite is the event of UPDATE and DELETE statements affecting
+	// more than MaxAffectedRows rows.
+	EventLargeWrite = "large_write"
+	// EventMissingWhere is the event of UPDATE and DELETE statements without
+	// WHERE clause, with WarnMissingWhere.
+	EventMissingWhere = "missing_where"
+	// EventLongTransaction is the event of COMMIT and ROLLBACK statements
+	// ending a transaction longer than LongTxnThreshold.
+	EventLongTransaction = "long_transaction"
+	// EventTooManyRows is the event of the queries with more rows than their
+	// ExpectedMaxRows.
+	EventTooManyRows = "too_many_rows"
+	// EventLargeResult is the event of the queries returning more than
+	// LargeResultBytes bytes.
+	EventLargeResult = "large_result"
+	// EventLargeTempUsage is the event of the queries writing more than
+	// LargeTempBytes bytes of temporary files.
+	EventLargeTempUsage = "large_temp_usage"
+)
+
+const (
+	defaultTraceMessage        = "trace"
+	defaultLargeWriteMessage   = "unexpectedly large write"
+	defaultMissingWhereMessage = "write without where clause"
+	defaultTooManyRowsMessage  = "more rows than expected"
+	defaultLargeResultMessage  = "large result"
+	defaultLargeTempMessage    = "query spilled to disk"
+)
+
+// FullTableMarker marks the UPDATE and DELETE statements meant to affect
+// whole tables, which WarnMissingWhere does not report, e.g.
+// db.Exec("DELETE FROM sessions /* zapgorm2:full-table */").
+const FullTableMarker = "zapgorm2:full-table"
+
+// isMissingWhere reports whether query is an UPDATE or DELETE statement
+// without WHERE clause nor FullTableMarker.
+func isMissingWhere(query *tracedQuery) bool {
+	switch query.verb() {
+	case "UPDATE", "DELETE":
+	default:
+		return false
+	}
+	sql, _ := query.get()
+	return !hasWhereClause(sql) && !strings.Contains(query.rawSQL(), FullTableMarker)
+}
+
+func (l Logger) traceMessage(event string, info TraceInfo) string {
+	if fn := l.traceMsgFn(event); fn != nil {
+		return fn(info)
+	}
+	var msg string
+	switch event {
+	case EventLargeWrite:
+		return defaultLargeWriteMessage
+	case EventMissingWhere:
+		return defaultMissingWhereMessage
+	case EventLongTransaction:
+		return defaultLongTxnMessage
+	case EventTooManyRows:
+		return defaultTooManyRowsMessage
+	case EventLargeResult:
+		return defaultLargeResultMessage
+	case EventLargeTempUsage:
+		return defaultLargeTempMessage
+	case EventError:
+		msg = l.ErrorMessage
+	case EventSlowQuery:
+		msg = l.SlowMessage
+	default:
+		msg = l.QueryMessage
+	}
+	if msg == "" {
+		return defaultTraceMessage
+	}
+	return msg
+}
+
+func (l Logger) traceMsgFn(event string) TraceMsgFn {
+	console := l.encoderKind() == EncoderKindConsole
+	switch {
+	case event == EventLargeWrite || event == EventMissingWhere || event == EventLongTransaction || event == EventTooManyRows || event == EventLargeResult || event == EventLargeTempUsage:
+		return nil
+	case event == EventError && (l.ErrorMsgFn != nil || !console):
+		return l.ErrorMsgFn
+	case event == EventError:
+		return gormErrorMsg
+	case event == EventSlowQuery && (l.SlowMsgFn != nil || !console):
+		return l.SlowMsgFn
+	case event == EventSlowQuery:
+		return gormSlowMsg
+	case l.QueryMsgFn != nil || !console:
+		return l.QueryMsgFn
+	default:
+		return gormQueryMsg
 	}
 }
 
@@ -96,27 +1607,246 @@ var (
 	zapgormPackage = filepath.Join("moul.io", "zapgorm2")
 )
 
-func (l Logger) logger(ctx context.Context) *zap.Logger {
-	logger := l.ZapLogger
+// logger returns the logger of the entries of ctx at level, with the context
+// fields and fields, and the caller as a caller field with a CallerFormat
+// other than CallerFormatFull.
+func (l Logger) logger(ctx context.Context, level zapcore.Level, caller callerInfo, fields ...zapcore.Field) *zap.Logger {
+	if !caller.suppressed && caller.file != "" && (l.CallerFormat != CallerFormatFull || l.CallerFormatFunc != nil) && l.zapAddsCaller() {
+		fields = append([]zapcore.Field{zap.String("caller", l.formatCaller(caller))}, fields...)
+	}
+	logger := l.withCaller(l.routedLogger(ctx, level), caller)
+	if all := l.ctxFields(ctx, level, fields); len(all) > 0 {
+		logger = logger.With(all...)
+	}
+	return logger
+}
+
+// traceLogger is like logger, for the Trace entries, whose caller field is
+// among fields, see traceFields. The fields are returned to be written
+// with the entry instead.
+func (l Logger) traceLogger(ctx context.Context, level zapcore.Level, caller callerInfo, fields []zapcore.Field) (*zap.Logger, []zapcore.Field) {
+	return l.withCaller(l.routedLogger(ctx, level), caller), l.entryFields(ctx, level, fields)
+}
+
+// entryFields returns all the fields of the Trace entry of ctx at level
+// with fields, deduplicated with DedupFields.
+func (l Logger) entryFields(ctx context.Context, level zapcore.Level, fields []zapcore.Field) []zapcore.Field {
+	all := l.ctxFields(ctx, level, fields)
+	if l.DedupFields {
+		return dedupFields(all)
+	}
+	return all
+}
+
+// ctxFields returns, in a new slice, the fields of the entries of ctx at
+// level: the ones returned by Context, then nested under Namespace the ones
+// of every entry and fields. The slice returned by Context may have a spare
+// capacity that its caller still owns.
+func (l Logger) ctxFields(ctx context.Context, level zapcore.Level, fields []zapcore.Field) []zapcore.Field {
+	var ctxFields []zapcore.Field
 	if l.Context != nil {
-		fields := l.Context(ctx)
-		logger = logger.With(fields...)
+		ctxFields = l.contextFields(ctx)
+	}
+	all := make([]zapcore.Field, 0, len(ctxFields)+len(fields)+6)
+	all = append(all, ctxFields...)
+	var correlationID string
+	if l.GenerateCorrelationID && !hasField(ctxFields, correlationIDKey) {
+		correlationID, _ = CorrelationIDFromContext(ctx)
+	}
+	if l.Namespace != "" && (len(fields) > 0 || correlationID != "" || l.Version != "" || l.Host != "" || l.Port != 0 || l.SeverityField) {
+		all = append(all, zap.Namespace(l.Namespace))
+	}
+	if correlationID != "" {
+		all = append(all, zap.String(correlationIDKey, correlationID))
+	}
+	if l.Version != "" {
+		all = append(all, zap.String("app_version", l.Version))
+	}
+	if l.Host != "" {
+		all = append(all, zap.String("db_host", l.Host))
+	}
+	if l.Port != 0 {
+		all = append(all, zap.Int("db_port", l.Port))
+	}
+	if l.SeverityField {
+		all = append(all, l.severityField(level))
+	}
+	return append(all, fields...)
+}
+
+func (l Logger) withCaller(logger *zap.Logger, caller callerInfo) *zap.Logger {
+	switch {
+	case caller.suppressed:
+		logger = logger.WithOptions(zap.WithCaller(false))
+	case caller.file == "":
+	case l.CallerFormat != CallerFormatFull || l.CallerFormatFunc != nil:
+		// The caller is a caller field, see logger and traceFields.
+		logger = logger.WithOptions(zap.WithCaller(false))
+	case caller.skip > 0:
+		logger = logger.WithOptions(zap.AddCallerSkip(caller.skip))
+	}
+	return logger
+}
+
+func (l Logger) contextFields(ctx context.Context) (fields []zapcore.Field) {
+	if l.RecoverContextFunc {
+		defer func() {
+			if r := recover(); r != nil {
+				l.ZapLogger.Debug("context function panicked", zap.Any("panic", r))
+				fields = nil
+			}
+		}()
 	}
+	return l.Context(ctx)
+}
 
+const correlationIDKey = "correlation_id"
+
+func hasField(fields []zapcore.Field, key string) bool {
+	for _, f := range fields {
+		if f.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+type callerInfo struct {
+	skip       int
+	file       string
+	line       int
+	suppressed bool
+}
+
+func (l Logger) isSuppressedCaller(file string) bool {
+	for _, pkg := range l.SuppressCallerForPackages {
+		if strings.Contains(file, pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+// CallerFormat is the way the caller of entries is rendered.
+type CallerFormat int
+
+const (
+	// CallerFormatFull lets zap annotate entries with the caller, formatted
+	// by its encoder, and renders it as the full file path and line for the
+	// callbacks.
+	CallerFormatFull CallerFormat = iota
+	// CallerFormatBase logs the caller as a caller field holding the file
+	// base name and line, e.g. user.go:42.
+	CallerFormatBase
+)
+
+const maxCallerProbes = 64
+
+// callerProbes caches addsCaller per zap logger, so that loggers are not
+// probed for every entry.
+type callerProbes struct {
+	mu     sync.Mutex
+	probed map[*zap.Logger]bool
+}
+
+// zapAddsCaller reports whether ZapLogger annotates its entries with their
+// caller, see addsCaller.
+func (l Logger) zapAddsCaller() bool {
+	if l.callers == nil {
+		return addsCaller(l.ZapLogger)
+	}
+	l.callers.mu.Lock()
+	defer l.callers.mu.Unlock()
+	if adds, ok := l.callers.probed[l.ZapLogger]; ok {
+		return adds
+	}
+	if l.callers.probed == nil || len(l.callers.probed) >= maxCallerProbes {
+		l.callers.probed = make(map[*zap.Logger]bool)
+	}
+	adds := addsCaller(l.ZapLogger)
+	l.callers.probed[l.ZapLogger] = adds
+	return adds
+}
+
+// addsCaller reports whether logger annotates its entries with their
+// caller, which zap does not expose: the caller of an entry checked through
+// a core accepting everything is only set with zap.AddCaller.
+func addsCaller(logger *zap.Logger) bool {
+	if logger == nil {
+		return false
+	}
+	probe := logger.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core { return probeCore{zapcore.NewNopCore()} }))
+	ce := probe.Check(zapcore.DebugLevel, "")
+	return ce != nil && ce.Caller.Defined
+}
+
+// probeCore accepts all the entries and writes none, see addsCaller.
+type probeCore struct{ zapcore.Core }
+
+func (probeCore) Enabled(zapcore.Level) bool { return true }
+
+func (c probeCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+func (l Logger) formatCaller(caller callerInfo) string {
+	switch {
+	case caller.file == "":
+		return ""
+	case l.CallerFormatFunc != nil:
+		return l.CallerFormatFunc(caller.file, caller.line)
+	case l.CallerFormat == CallerFormatBase:
+		return filepath.Base(caller.file) + ":" + strconv.Itoa(caller.line)
+	default:
+		return caller.file + ":" + strconv.Itoa(caller.line)
+	}
+}
+
+// caller returns the first frame outside of gorm and zapgorm2. It must be
+// called directly by the method writing the entry, so that its skip can be
+// applied to that method's zap call.
+func (l Logger) caller() callerInfo {
 	if l.SkipCallerLookup {
-		return logger
+		return callerInfo{}
 	}
 
 	for i := 2; i < 15; i++ {
-		_, file, _, ok := runtime.Caller(i)
+		_, file, line, ok := runtime.Caller(i)
 		switch {
 		case !ok:
 		case strings.HasSuffix(file, "_test.go"):
 		case strings.Contains(file, gormPackage):
 		case strings.Contains(file, zapgormPackage):
+		case l.isSuppressedCaller(file):
+			return callerInfo{suppressed: true}
 		default:
-			return logger.WithOptions(zap.AddCallerSkip(i))
+			return callerInfo{skip: i - 1, file: file, line: line}
 		}
 	}
-	return logger
+	return callerInfo{}
+}
+
+// dedupFields removes the fields whose key appears again later in the same
+// namespace, keeping the order of the remaining ones.
+func dedupFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, 0, len(fields))
+	start := 0
+	for i, f := range fields {
+		if f.Type != zapcore.NamespaceType {
+			continue
+		}
+		out = appendLastOccurrences(out, fields[start:i])
+		out = append(out, f)
+		start = i + 1
+	}
+	return appendLastOccurrences(out, fields[start:])
+}
+
+func appendLastOccurrences(out, fields []zapcore.Field) []zapcore.Field {
+	for i, f := range fields {
+		if !hasField(fields[i+1:], f.Key) {
+			out = append(out, f)
+		}
+	}
+	return out
 }
@@ -2,13 +2,21 @@ package zapgorm2_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 	"moul.io/zapgorm2"
 )
 
@@ -59,3 +67,1922 @@ func TestContextFunc(t *testing.T) {
 	require.Equal(t, value2, entry.ContextMap()[string(key2)])
 
 }
+
+func TestStructuredMessages(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	ctx := context.Background()
+
+	logger.Error(ctx, "test %d", 1)
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, "test 1", logs.All()[0].Message)
+
+	logger.StructuredMessages = true
+	logger.Error(ctx, "test %d", 1)
+	require.Equal(t, 2, logs.Len())
+	entry := logs.All()[1]
+	require.Equal(t, zap.ErrorLevel, entry.Level)
+	require.Equal(t, "error", entry.Message)
+	require.Equal(t, "test %d", entry.ContextMap()["gorm_msg"])
+	require.Equal(t, []interface{}{1}, entry.ContextMap()["args"])
+}
+
+func TestTrimMessage(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	ctx := context.Background()
+
+	logger.Warn(ctx, "migrating %s\n", "users")
+	logger.TrimMessage = true
+	logger.Warn(ctx, "migrating %s\n", "users")
+	logger.Error(ctx, "failed: %v \r\n\t", errors.New("boom"))
+	logger.Error(ctx, "100%\n")
+	require.Equal(t, 4, logs.Len())
+	require.Equal(t, "migrating users\n", logs.All()[0].Message, "TrimMessage is off by default")
+	require.Equal(t, "migrating users", logs.All()[1].Message)
+	require.Equal(t, "failed: boom", logs.All()[2].Message)
+	require.Equal(t, "100%", logs.All()[3].Message)
+}
+
+func TestTagGormInternal(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.TagGormInternal = true
+	ctx := context.Background()
+
+	logger.Warn(ctx, "record not found for %s", "users")
+	logger.Trace(ctx, time.Now().Add(-time.Second), func() (string, int64) { return "SELECT 1", 1 }, nil)
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, true, logs.All()[0].ContextMap()["gorm_internal"])
+	require.Equal(t, zapgorm2.EventSlowQuery, logs.All()[1].ContextMap()["gorm_event"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "gorm_internal")
+}
+
+func TestCompactMode(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.CompactMode = true
+	logger.LogLevel = gormlogger.Info
+	ctx := context.Background()
+	begin := time.Now()
+
+	logger.Trace(ctx, begin, func() (string, int64) { return "SELECT * FROM users", 3 }, nil)
+	logger.Trace(ctx, begin, func() (string, int64) { return "UPDATE users SET name = 'a' WHERE id = 1", 0 }, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	for i, pattern := range []string{
+		`^op=select rows=3 elapsed=\S+$`,
+		`^op=update rows=0 elapsed=\S+ event=error error=boom$`,
+	} {
+		fields := logs.All()[i].ContextMap()
+		require.Len(t, fields, 1)
+		require.Regexp(t, pattern, fields["q"])
+	}
+}
+
+func TestSlowQuietHours(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.TimeZone = time.FixedZone("UTC-5", -5*60*60)
+	logger.SlowQuietHours = []zapgorm2.TimeOfDayRange{{Start: 22 * time.Hour, End: 6 * time.Hour}}
+	var hooked []string
+	logger.OnSlowQuery = func(ctx context.Context, sql string, rows int64, elapsed time.Duration) {
+		hooked = append(hooked, sql)
+	}
+	trace := func(sql string, begin time.Time) {
+		logger.Trace(context.Background(), begin, func() (string, int64) { return sql, 1 }, nil)
+	}
+
+	trace("SELECT 1", time.Date(2022, 6, 1, 3, 0, 0, 0, time.UTC))
+	trace("SELECT 2", time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC))
+	trace("SELECT 3", time.Date(2022, 6, 1, 23, 0, 0, 0, time.UTC))
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, zapcore.InfoLevel, logs.All()[0].Level, "22:00 in TimeZone is in the quiet hours")
+	require.Equal(t, zapcore.WarnLevel, logs.All()[1].Level)
+	require.Equal(t, zapcore.WarnLevel, logs.All()[2].Level, "18:00 in TimeZone is not in the quiet hours")
+	require.Equal(t, []string{"SELECT 2", "SELECT 3"}, hooked)
+}
+
+func TestTraceEvent(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.SlowMessage = "slow query"
+	logger.ErrorMessage = "query failed"
+	ctx := context.Background()
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(ctx, time.Now().Add(-time.Second), fc, nil)
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "slow query", logs.All()[0].Message)
+	require.Equal(t, zapgorm2.EventSlowQuery, logs.All()[0].ContextMap()["gorm_event"])
+	require.Equal(t, "query failed", logs.All()[1].Message)
+	require.Equal(t, zapgorm2.EventError, logs.All()[1].ContextMap()["gorm_event"])
+
+	logger.EventField = false
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.NotContains(t, logs.All()[2].ContextMap(), "gorm_event")
+}
+
+func TestMigrationTag(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.TagDDL = true
+	ctx := context.Background()
+	begin := time.Now().Add(-time.Second)
+
+	logger.Trace(ctx, begin, func() (string, int64) { return "CREATE TABLE `users` (`id` integer)", 0 }, nil)
+	logger.Trace(ctx, begin, func() (string, int64) { return "SELECT * FROM `users`", 0 }, nil)
+	logger.Trace(zapgorm2.ContextForMigration(ctx), begin, func() (string, int64) { return "SELECT * FROM `users`", 0 }, nil)
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, true, logs.All()[0].ContextMap()["migration"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "migration")
+	require.Equal(t, true, logs.All()[2].ContextMap()["migration"])
+}
+
+func TestTraceNilContext(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.TagDDL = true
+	logger.LogSQLArgs = true
+	logger.LogParamsHash = true
+	logger.LogCallback = true
+	logger.LogModel = true
+	fc := func() (string, int64) { return "CREATE TABLE `users` (`id` integer)", 0 }
+
+	require.NotPanics(t, func() {
+		logger.Trace(nil, time.Now(), fc, errors.New("boom")) //nolint:staticcheck
+	})
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, true, logs.All()[0].ContextMap()["migration"])
+}
+
+func TestTee(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	otherZaplogger, otherLogs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger).Tee(zapgorm2.New(otherZaplogger))
+	ctx := context.Background()
+
+	logger.Error(ctx, "test %d", 1)
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, 2, otherLogs.Len())
+
+	silent := logger.LogMode(gormlogger.Silent)
+	silent.Error(ctx, "test %d", 1)
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, 2, otherLogs.Len())
+}
+
+func TestCompactSQL(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.CompactSQL = true
+	fc := func() (string, int64) {
+		return "\n\tSELECT *\n\tFROM `users`\n\tWHERE name = 'a  b'\n", 1
+	}
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, "SELECT * FROM `users` WHERE name = 'a  b'", logs.All()[0].ContextMap()["sql"])
+}
+
+func TestStripSQLComments(t *testing.T) {
+	tests := []struct {
+		sql      string
+		stripped string
+	}{
+		{"/* app:users */ SELECT * FROM users", "SELECT * FROM users"},
+		{"SELECT * FROM users -- by id\nWHERE id = 1", "SELECT * FROM users WHERE id = 1"},
+		{"SELECT a/**/FROM t", "SELECT a FROM t"},
+		{"SELECT '/* kept */', '-- kept' FROM t -- trailing", "SELECT '/* kept */', '-- kept' FROM t"},
+	}
+	for _, tt := range tests {
+		zaplogger, logs := setupLogsCapture()
+		logger := zapgorm2.New(zaplogger)
+		logger.StripSQLComments = true
+		sql := tt.sql
+		fc := func() (string, int64) { return sql, 1 }
+		logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+		logger.SQLMode = zapgorm2.SQLModeHashOnly
+		logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+		require.Equal(t, tt.stripped, logs.All()[0].ContextMap()["sql"])
+		require.Equal(t, zapgorm2.SQLHash(tt.stripped), logs.All()[1].ContextMap()["sql_hash"])
+	}
+}
+
+func TestSQLFormatter(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.CompactSQL = true
+	logger.SQLFormatter = func(sql string) string {
+		return strings.Replace(sql, " FROM ", "\nFROM ", 1)
+	}
+	fc := func() (string, int64) { return "SELECT *\n\tFROM `users`", 1 }
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, "SELECT *\nFROM `users`", logs.All()[0].ContextMap()["sql"])
+}
+
+func TestSlowThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		elapsed   time.Duration
+		slow      bool
+	}{
+		{"zero disables", 0, time.Hour, false},
+		{"negative disables", -time.Second, time.Hour, false},
+		{"below threshold", time.Hour, time.Millisecond, false},
+		{"above threshold", time.Millisecond, time.Second, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			zaplogger, logs := setupLogsCapture()
+			logger := zapgorm2.New(zaplogger)
+			logger.SlowThreshold = tt.threshold
+
+			logger.Trace(context.Background(), time.Now().Add(-tt.elapsed), func() (string, int64) { return "SELECT 1", 1 }, nil)
+			if tt.slow {
+				require.Equal(t, 1, logs.Len())
+				require.Equal(t, zap.WarnLevel, logs.All()[0].Level)
+			} else {
+				require.Equal(t, 0, logs.Len())
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	var infos []zapgorm2.TraceInfo
+	logger.Metrics = func(ctx context.Context, info zapgorm2.TraceInfo) {
+		infos = append(infos, info)
+	}
+	ctx := context.Background()
+	fc := func() (string, int64) { return "SELECT 1", 3 }
+
+	logger.Trace(ctx, time.Now().Add(-time.Second), fc, nil)
+	require.Equal(t, 1, logs.Len())
+	require.Len(t, infos, 1)
+	require.True(t, infos[0].Slow)
+	require.Equal(t, "SELECT 1", infos[0].SQL)
+	require.Equal(t, int64(3), infos[0].Rows)
+	require.Regexp(t, `\.go:\d+$`, infos[0].Caller)
+
+	silent := logger.LogMode(gormlogger.Silent)
+	silent.Trace(ctx, time.Now(), fc, nil)
+	require.Equal(t, 1, logs.Len())
+	require.Len(t, infos, 2)
+	require.False(t, infos[1].Slow)
+
+	logger.SkipCallerLookup = true
+	logger.Trace(ctx, time.Now(), fc, nil)
+	require.Len(t, infos, 3)
+	require.Empty(t, infos[2].Caller)
+}
+
+func TestContextWithAttempt(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	ctx := zapgorm2.ContextWithAttempt(context.Background(), 2)
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	n, ok := zapgorm2.AttemptFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, 2, n)
+	_, ok = zapgorm2.AttemptFromContext(nil) //nolint:staticcheck
+	require.False(t, ok)
+
+	logger.Trace(ctx, time.Now().Add(-time.Second), fc, nil)
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, int64(2), logs.All()[0].ContextMap()["attempt"])
+	require.Equal(t, int64(2), logs.All()[1].ContextMap()["attempt"])
+	require.NotContains(t, logs.All()[2].ContextMap(), "attempt")
+}
+
+func TestLogQueryTime(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.LogQueryTime = true
+	logger.TimeZone = time.UTC
+	begin := time.Now().In(time.FixedZone("UTC+2", 2*60*60))
+
+	logger.Trace(context.Background(), begin, func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+	require.Equal(t, 1, logs.Len())
+	queryTime := logs.All()[0].ContextMap()["query_time"].(time.Time)
+	require.True(t, begin.Equal(queryTime))
+	require.Equal(t, time.UTC, queryTime.Location())
+}
+
+func TestSQLModeHashOnly(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.SQLMode = zapgorm2.SQLModeHashOnly
+	sql := "SELECT * FROM `users` WHERE email = 'secret@example.com'"
+
+	logger.Trace(context.Background(), time.Now(), func() (string, int64) { return sql, 1 }, errors.New("boom"))
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.NotContains(t, fields, "sql")
+	require.Equal(t, zapgorm2.SQLHash(sql), fields["sql_hash"])
+}
+
+func TestBranchFields(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	branchFields := func(name string) zapgorm2.TraceFieldsFn {
+		return func(ctx context.Context, sql string, rows int64, elapsed time.Duration, file string, err error) []zapcore.Field {
+			return []zapcore.Field{zap.String(name, sql)}
+		}
+	}
+	logger.QueryFields = branchFields("query")
+	logger.SlowFields = branchFields("slow")
+	logger.ErrorFields = branchFields("error_extra")
+	ctx := context.Background()
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(ctx, time.Now(), fc, nil)
+	logger.Trace(ctx, time.Now().Add(-time.Second), fc, nil)
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 3, logs.Len())
+	for i, name := range []string{"query", "slow", "error_extra"} {
+		fields := logs.All()[i].ContextMap()
+		require.Equal(t, "SELECT 1", fields[name])
+		for _, other := range []string{"query", "slow", "error_extra"} {
+			if other != name {
+				require.NotContains(t, fields, other)
+			}
+		}
+	}
+}
+
+func TestLogSQLArgs(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogSQLArgs = true
+	db := openDryRunDB(t, logger)
+
+	var users []testUser
+	db.Where("name = ? AND id > ?", "alice", 42).Find(&users)
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, `["alice",42]`, fields["args"])
+	require.NotContains(t, fields, "args_truncated")
+
+	logger.MaxArgsLength = 5
+	db = openDryRunDB(t, logger)
+	db.Where("name = ? AND id > ?", "alice", 42).Find(&users)
+	require.Equal(t, 2, logs.Len())
+	fields = logs.All()[1].ContextMap()
+	require.Equal(t, `["ali`, fields["args"])
+	require.Equal(t, true, fields["args_truncated"])
+
+	logger.MaxArgsLength = 0
+	db = openDryRunDB(t, logger)
+	db.Where("name = ? AND email = ?", (*sql.NullString)(nil), sql.NullString{String: "a@example.com", Valid: true}).Find(&users)
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, `[null,"a@example.com"]`, logs.All()[2].ContextMap()["args"])
+}
+
+// Postgres computes pg_stat_statements.queryid from the parse tree, which
+// cannot be reproduced from the SQL text alone; a hash of the fingerprint is
+// a close approximation that is stable across literal values, and can be
+// joined with a catalog mapping it to the Postgres queryid.
+func ExampleLogger_queryID() {
+	logger := zapgorm2.New(zap.L())
+	logger.QueryIDFunc = func(sql string) string {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(zapgorm2.Fingerprint(sql)))
+		return strconv.FormatUint(h.Sum64(), 10)
+	}
+
+	fmt.Println(logger.QueryIDFunc("SELECT * FROM users WHERE id = $1"))
+	fmt.Println(logger.QueryIDFunc("SELECT * FROM users WHERE id = 42"))
+	// Output:
+	// 10010606031982395717
+	// 10010606031982395717
+}
+
+func TestQueryIDFunc(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.QueryIDFunc = func(sql string) string {
+		if strings.HasPrefix(sql, "SELECT") {
+			return "select-id"
+		}
+		return ""
+	}
+	ctx := context.Background()
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "DELETE FROM users", 1 }, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "select-id", logs.All()[0].ContextMap()["query_id"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "query_id")
+}
+
+func TestCostFunc(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.CostFunc = func(sql string) (float64, bool) {
+		return 12.5, strings.Contains(sql, "users")
+	}
+	ctx := context.Background()
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM users", 1 }, errors.New("boom"))
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, 12.5, logs.All()[0].ContextMap()["estimated_cost"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "estimated_cost")
+}
+
+func TestIndexHintFunc(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.IndexHintFunc = func(ctx context.Context, sql string) (string, bool) {
+		if strings.Contains(sql, "email") {
+			return "index:idx_users_email", true
+		}
+		return "", false
+	}
+	ctx := context.Background()
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM users WHERE email = 'a'", 1 }, errors.New("boom"))
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM users", 1 }, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "index:idx_users_email", logs.All()[0].ContextMap()["index_hint"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "index_hint")
+}
+
+func TestOnSlowQuery(t *testing.T) {
+	zaplogger, _ := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger).LogMode(gormlogger.Silent).(zapgorm2.Logger)
+	var slowSQL []string
+	logger.OnSlowQuery = func(ctx context.Context, sql string, rows int64, elapsed time.Duration) {
+		require.Greater(t, int64(elapsed), int64(logger.SlowThreshold))
+		slowSQL = append(slowSQL, sql)
+	}
+	ctx := context.Background()
+	slowBegin := time.Now().Add(-time.Second)
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT fast", 1 }, nil)
+	logger.Trace(ctx, slowBegin, func() (string, int64) { return "SELECT slow", 1 }, nil)
+	logger.Trace(ctx, slowBegin, func() (string, int64) { return "SELECT slow error", 1 }, errors.New("boom"))
+	require.Equal(t, []string{"SELECT slow", "SELECT slow error"}, slowSQL)
+}
+
+func TestSlowQuerySampleRate(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.SlowQuerySampleRate = 4
+	var slowSQL []string
+	logger.OnSlowQuery = func(ctx context.Context, sql string, rows int64, elapsed time.Duration) {
+		slowSQL = append(slowSQL, sql)
+	}
+	metrics := 0
+	logger.Metrics = func(context.Context, zapgorm2.TraceInfo) { metrics++ }
+	ctx := context.Background()
+	slowBegin := time.Now().Add(-time.Second)
+	fc := func() (string, int64) { return "SELECT slow", 1 }
+
+	for i := 0; i < 10; i++ {
+		logger.Trace(ctx, slowBegin, fc, nil)
+	}
+	require.Len(t, slowSQL, 3)
+	require.Equal(t, 10, metrics)
+	require.Equal(t, 10, logs.Len(), "the slow log is not sampled by default")
+	require.Equal(t, zapgorm2.Stats{SlowQueries: 10, SuppressedSlowQueries: 7}, logger.Stats())
+
+	logger.SampleSlowLog = true
+	for i := 0; i < 6; i++ {
+		logger.Trace(ctx, slowBegin, fc, nil)
+	}
+	logger.Trace(ctx, slowBegin, fc, errors.New("boom"))
+	logger.Trace(ctx, slowBegin, fc, errors.New("boom"))
+	require.Len(t, slowSQL, 5)
+	require.Equal(t, 10+1+2, logs.Len(), "failed queries are always logged")
+	require.Equal(t, zapgorm2.Stats{SlowQueries: 18, SuppressedSlowQueries: 13}, logger.Stats())
+	require.Equal(t, zapgorm2.Stats{}, zapgorm2.Logger{}.Stats())
+}
+
+func TestOnError(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.IgnoreRecordNotFoundError = true
+	var errs []error
+	logger.OnError = func(ctx context.Context, sql string, err error) {
+		require.Equal(t, 1, logs.Len(), "OnError is called after logging")
+		errs = append(errs, err)
+	}
+	ctx := context.Background()
+	fc := func() (string, int64) { return "SELECT 1", 0 }
+	boom := errors.New("boom")
+
+	logger.Trace(ctx, time.Now(), fc, nil)
+	logger.Trace(ctx, time.Now(), fc, gorm.ErrRecordNotFound)
+	logger.Trace(ctx, time.Now(), fc, boom)
+	require.Equal(t, []error{boom}, errs)
+
+	logs.TakeAll()
+	logger.OnError = func(ctx context.Context, sql string, err error) { errs = append(errs, err) }
+	silent := logger.LogMode(gormlogger.Silent)
+	silent.Trace(ctx, time.Now(), fc, boom)
+	require.Equal(t, []error{boom, boom}, errs)
+	require.Equal(t, 0, logs.Len())
+}
+
+func TestLogArgsOnError(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogArgsOnError = true
+	db := openDryRunDB(t, logger)
+
+	var users []testUser
+	db.Where("name = ?", "alice").Find(&users)
+	failQueries(t, db)
+	db.Where("name = ?", "bob").Find(&users)
+	require.Equal(t, 2, logs.Len())
+	require.NotContains(t, logs.All()[0].ContextMap(), "args")
+	require.Equal(t, zap.ErrorLevel, logs.All()[1].Level)
+	require.Contains(t, logs.All()[1].ContextMap()["args"], `"bob"`)
+
+	logger.LogSQLArgs = true
+	db = openDryRunDB(t, logger)
+	db.Where("name = ?", "alice").Find(&users)
+	require.Equal(t, `["alice"]`, logs.All()[2].ContextMap()["args"])
+}
+
+func TestVerboseSlow(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.VerboseSlow = true
+	logger.SlowThreshold = time.Hour
+	var users []testUser
+	openDryRunDB(t, logger).Where("name = ?", "alice").Find(&users)
+	logger.SlowThreshold = time.Nanosecond
+	openDryRunDB(t, logger).Where("name = ?", "bob").Find(&users)
+
+	require.Equal(t, 2, logs.Len())
+	fast := logs.All()[0].ContextMap()
+	require.Equal(t, "query", fast["gorm_event"])
+	require.NotContains(t, fast, "args")
+	require.NotContains(t, fast, "stack")
+	slow := logs.All()[1].ContextMap()
+	require.Equal(t, "slow_query", slow["gorm_event"])
+	require.Equal(t, `["bob"]`, slow["args"])
+	require.Contains(t, slow["stack"], "zapgorm2_test.TestVerboseSlow")
+	require.NotContains(t, slow["stack"], "zapgorm2.Logger.traceFields")
+
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+	logger.Trace(context.Background(), time.Now().Add(-time.Second), fc, nil)
+	require.Equal(t, 3, logs.Len())
+	_, _, rendered := logger.RenderTrace(time.Now().Add(-time.Second), fc, nil)
+	stacks := map[string]interface{}{
+		"Trace":       logs.All()[2].ContextMap()["stack"],
+		"RenderTrace": fieldValue(rendered, "stack"),
+		"TraceFields": fieldValue(logger.TraceFields(time.Now().Add(-time.Second), fc, nil), "stack"),
+	}
+	for name, stack := range stacks {
+		require.Regexp(t, `^moul\.io/zapgorm2_test\.TestVerboseSlow\n`, stack, "the first frame of %s is its caller", name)
+	}
+}
+
+// fieldValue returns the value of the field named key, as encoded in a
+// ContextMap.
+func fieldValue(fields []zapcore.Field, key string) interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return enc.Fields[key]
+}
+
+func TestCallerFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(*zapgorm2.Logger)
+		caller string
+	}{
+		{"full", func(l *zapgorm2.Logger) {}, ""},
+		{"base", func(l *zapgorm2.Logger) { l.CallerFormat = zapgorm2.CallerFormatBase }, `^testing\.go:\d+$`},
+		{"func", func(l *zapgorm2.Logger) {
+			l.CallerFormatFunc = func(file string, line int) string { return fmt.Sprintf("%s :: %d", file, line) }
+		}, `/testing\.go :: \d+$`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			zaplogger, logs := setupLogsCapture()
+			logger := zapgorm2.New(zaplogger.WithOptions(zap.AddCaller()))
+			tt.setup(&logger)
+
+			logger.Error(context.Background(), "test")
+			require.Equal(t, 1, logs.Len())
+			entry := logs.All()[0]
+			if tt.caller == "" {
+				require.True(t, entry.Caller.Defined)
+				require.NotContains(t, entry.ContextMap(), "caller")
+				return
+			}
+			require.False(t, entry.Caller.Defined)
+			require.Regexp(t, tt.caller, entry.ContextMap()["caller"])
+		})
+	}
+
+	t.Run("without zap caller", func(t *testing.T) {
+		zaplogger, logs := setupLogsCapture()
+		logger := zapgorm2.New(zaplogger.WithOptions(zap.AddCaller()))
+		logger.CallerFormat = zapgorm2.CallerFormatBase
+		logger.Error(context.Background(), "test")
+		require.Equal(t, 1, logs.Len())
+		require.Contains(t, logs.All()[0].ContextMap(), "caller")
+
+		logger.ZapLogger = zaplogger
+		logger.Error(context.Background(), "test")
+		logger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+		require.Equal(t, 3, logs.Len())
+		for _, entry := range logs.All()[1:] {
+			require.False(t, entry.Caller.Defined)
+			require.NotContains(t, entry.ContextMap(), "caller")
+		}
+	})
+}
+
+func TestSuppressCallerForPackages(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger.WithOptions(zap.AddCaller()))
+	logger.CallerFormat = zapgorm2.CallerFormatBase
+	logger.SuppressCallerForPackages = []string{"/src/testing/"}
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Error(context.Background(), "test")
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	for _, entry := range logs.All() {
+		require.False(t, entry.Caller.Defined)
+		require.NotContains(t, entry.ContextMap(), "caller")
+	}
+}
+
+func TestAddCore(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	auditCore, auditLogs := observer.New(zap.InfoLevel)
+	logger := zapgorm2.New(zaplogger)
+	audited := logger.AddCore(auditCore)
+	ctx := context.Background()
+
+	audited.Error(ctx, "audited")
+	logger.Error(ctx, "not audited")
+	zaplogger.Error("app")
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, 1, auditLogs.Len())
+	require.Equal(t, "audited", auditLogs.All()[0].Message)
+}
+
+func TestEnabled(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	enabled := false
+	logger.Enabled = func() bool { return enabled }
+	metrics := 0
+	logger.Metrics = func(ctx context.Context, info zapgorm2.TraceInfo) { metrics++ }
+	ctx := context.Background()
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Error(ctx, "test")
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 0, logs.Len())
+	require.Equal(t, 1, metrics)
+
+	enabled = true
+	logger.Error(ctx, "test")
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, 2, metrics)
+}
+
+func TestMaxAffectedRows(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.MaxAffectedRows = 100
+	ctx := context.Background()
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "DELETE FROM `users` WHERE age > 18", 100 }, nil)
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM `users`", 5000 }, nil)
+	require.Equal(t, 0, logs.Len())
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "DELETE FROM `users` WHERE age > 18", 5000 }, nil)
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	require.Equal(t, zap.WarnLevel, entry.Level)
+	require.Equal(t, "unexpectedly large write", entry.Message)
+	require.Equal(t, zapgorm2.EventLargeWrite, entry.ContextMap()["gorm_event"])
+}
+
+func TestErrorField(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.ErrorField = func(err error) zapcore.Field {
+		msg := err.Error()
+		if len(msg) > 10 {
+			msg = msg[:10] + "..."
+		}
+		return zap.String("db_error", msg)
+	}
+
+	logger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New(strings.Repeat("x", 100)))
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.NotContains(t, fields, "error")
+	require.Equal(t, "xxxxxxxxxx...", fields["db_error"])
+}
+
+func TestNoLogMarker(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.NoLogMarker = "/* zapgorm2:nolog */"
+	ctx := context.Background()
+	slowBegin := time.Now().Add(-time.Second)
+	marked := func() (string, int64) { return "/* zapgorm2:nolog */ SELECT * FROM reports", 1 }
+
+	logger.Trace(ctx, slowBegin, marked, nil)
+	require.Equal(t, 0, logs.Len())
+	logger.Trace(ctx, slowBegin, func() (string, int64) { return "SELECT * FROM reports", 1 }, nil)
+	require.Equal(t, 1, logs.Len())
+	logger.Trace(ctx, slowBegin, marked, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, zap.ErrorLevel, logs.All()[1].Level)
+}
+
+func TestLogBeginTime(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	ctx := context.Background()
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+	begin := time.Now()
+
+	logger.Trace(ctx, begin, fc, errors.New("boom"))
+	require.NotContains(t, logs.All()[0].ContextMap(), "begin")
+
+	logger.LogBeginTime = true
+	logger.TimeZone = time.UTC
+	logger.Trace(ctx, begin, fc, errors.New("boom"))
+	logged := logs.All()[1].ContextMap()["begin"].(time.Time)
+	require.True(t, begin.Equal(logged))
+	require.Equal(t, time.UTC, logged.Location())
+}
+
+func TestContextSilenced(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	metrics := 0
+	logger.Metrics = func(ctx context.Context, info zapgorm2.TraceInfo) { metrics++ }
+	silenced := zapgorm2.ContextSilenced(context.Background())
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Warn(silenced, "test")
+	logger.Trace(silenced, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 0, logs.Len())
+	require.Equal(t, 1, metrics)
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 1, logs.Len())
+}
+
+func TestLogParamCount(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.LogParamCount = true
+	ctx := context.Background()
+	trace := func(sql string) {
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return sql, 1 }, errors.New("boom"))
+	}
+
+	trace("SELECT * FROM `users` WHERE `id` IN (1,2,3,'four?')")
+	trace("SELECT * FROM `users?` WHERE name = 'it''s?' /* ? */")
+	trace("SELECT * FROM users WHERE id = $1")
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, int64(4), logs.All()[0].ContextMap()["param_count"])
+	require.Equal(t, int64(1), logs.All()[1].ContextMap()["param_count"])
+	require.Equal(t, int64(1), logs.All()[2].ContextMap()["param_count"])
+}
+
+func TestLogTableCount(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.LogTableCount = true
+	ctx := context.Background()
+	trace := func(sql string) {
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return sql, 1 }, errors.New("boom"))
+	}
+
+	trace("SELECT * FROM users WHERE id = 1")
+	trace("SELECT * FROM `users` u JOIN orders AS o ON o.user_id = u.id LEFT JOIN public.items i ON i.order_id = o.id")
+	trace("SELECT * FROM users, orders o WHERE o.user_id = users.id AND users.id IN (SELECT user_id FROM bans)")
+	trace("UPDATE users SET name = 'from x' WHERE id = 1")
+	trace("INSERT INTO users (name) VALUES ('a') ON DUPLICATE KEY UPDATE name = 'a'")
+	trace("SELECT * FROM Users JOIN users ON 1 = 1 FOR UPDATE SKIP LOCKED")
+	trace("SELECT * FROM ONLY users NATURAL JOIN orders")
+	require.Equal(t, 7, logs.Len())
+	for i, expected := range []int64{1, 3, 3, 1, 1, 1, 2} {
+		require.Equal(t, expected, logs.All()[i].ContextMap()["table_count"], logs.All()[i].ContextMap()["sql"])
+	}
+}
+
+func TestNamed(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger.Named("gorm"))
+	logger.SlowThreshold = time.Second
+	reporting := logger.Named("reporting")
+	require.Equal(t, time.Second, reporting.SlowThreshold)
+
+	reporting.Error(context.Background(), "test")
+	logger.Error(context.Background(), "test")
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "gorm.reporting", logs.All()[0].LoggerName)
+	require.Equal(t, "gorm", logs.All()[1].LoggerName)
+}
+
+func TestShutdownMode(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	derived := logger.LogMode(gormlogger.Warn)
+	ctx := context.Background()
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.ShutdownMode()
+	derived.Trace(ctx, time.Now(), fc, context.Canceled)
+	derived.Trace(ctx, time.Now().Add(-time.Second), fc, nil)
+	derived.Error(ctx, "connection closed")
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, zap.DebugLevel, logs.All()[0].Level)
+	require.Equal(t, zapgorm2.EventError, logs.All()[0].ContextMap()["gorm_event"])
+	require.Equal(t, zap.DebugLevel, logs.All()[1].Level)
+	require.Equal(t, "connection closed", logs.All()[1].Message)
+}
+
+func TestLogPlaceholderStyle(t *testing.T) {
+	tests := []struct {
+		sql   string
+		style string
+	}{
+		{"SELECT * FROM users WHERE id = ? AND name = '$1'", "qmark"},
+		{"SELECT * FROM users WHERE id = $1 AND created_at > now()::date", "dollar"},
+		{"SELECT * FROM users WHERE id = @id OR name = :name", "named"},
+		{"SELECT * FROM users WHERE id = ? AND name = $2", "mixed"},
+		{"SELECT * FROM users WHERE name = 'what?' /* :name */", "none"},
+	}
+	for _, tt := range tests {
+		zaplogger, logs := setupLogsCapture()
+		logger := zapgorm2.New(zaplogger)
+		logger.LogPlaceholderStyle = true
+		sql := tt.sql
+		logger.Trace(context.Background(), time.Now(), func() (string, int64) { return sql, 1 }, errors.New("boom"))
+		require.Equal(t, tt.style, logs.All()[0].ContextMap()["placeholder_style"], tt.sql)
+	}
+}
+
+func TestErrorLogOnce(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.ErrorLogOnce = true
+	var failures int
+	logger.OnError = func(context.Context, string, error) { failures++ }
+	fc := func() (string, int64) { return "SELECT * FROM missing", 0 }
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("value 1 out of range for column age"))
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("value 2 out of range for column age"))
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("connection refused"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "value 1 out of range for column age", logs.All()[0].ContextMap()["error"])
+	require.Equal(t, "connection refused", logs.All()[1].ContextMap()["error"])
+	require.Equal(t, 3, failures)
+
+	logger.PoolErrorLevel = zap.DebugLevel
+	logger.IsPoolError = func(error) bool { return true }
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("too many clients"))
+	require.Equal(t, 2, logs.Len(), "the core drops the debug entries")
+	logger.IsPoolError = nil
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("too many clients"))
+	require.Equal(t, 3, logs.Len(), "dropped errors are not recorded")
+}
+
+func TestNamespace(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.Namespace = "gorm"
+	logger.Context = func(context.Context) []zapcore.Field { return []zapcore.Field{zap.String("sql", "app")} }
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, "app", fields["sql"])
+	require.Equal(t, map[string]interface{}{
+		"error":      "boom",
+		"elapsed":    fields["gorm"].(map[string]interface{})["elapsed"],
+		"rows":       int64(1),
+		"sql":        "SELECT 1",
+		"gorm_event": "error",
+	}, fields["gorm"])
+
+	logger.StructuredMessages = true
+	logger.Error(context.Background(), "failed %d times", 2)
+	require.Equal(t, 2, logs.Len())
+	fields = logs.All()[1].ContextMap()
+	require.Equal(t, "app", fields["sql"])
+	require.Equal(t, map[string]interface{}{"gorm_msg": "failed %d times", "args": []interface{}{2}}, fields["gorm"])
+
+	logger.StructuredMessages = false
+	logger.TagGormInternal = true
+	logger.Warn(context.Background(), "deprecated")
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, map[string]interface{}{"gorm_internal": true}, logs.All()[2].ContextMap()["gorm"])
+	require.NotContains(t, logs.All()[2].ContextMap(), "gorm_internal")
+
+	logger.TagGormInternal = false
+	logger.Version, logger.Host, logger.Port = "v1.0.0", "db", 5432
+	logger.Warn(context.Background(), "connected")
+	require.Equal(t, 4, logs.Len())
+	require.Equal(t, map[string]interface{}{"app_version": "v1.0.0", "db_host": "db", "db_port": int64(5432)}, logs.All()[3].ContextMap()["gorm"])
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 5, logs.Len())
+	fields = logs.All()[4].ContextMap()
+	require.NotContains(t, fields, "app_version")
+	require.Equal(t, "v1.0.0", fields["gorm"].(map[string]interface{})["app_version"])
+	require.Equal(t, "SELECT 1", fields["gorm"].(map[string]interface{})["sql"])
+
+	logger.Version, logger.Host, logger.Port = "", "", 0
+	logger.SeverityField = true
+	logger.GenerateCorrelationID = true
+	ctx := zapgorm2.ContextWithCorrelationID(context.Background())
+	id, _ := zapgorm2.CorrelationIDFromContext(ctx)
+	logger.Warn(ctx, "connected")
+	require.Equal(t, 6, logs.Len())
+	fields = logs.All()[5].ContextMap()
+	require.Equal(t, "app", fields["sql"])
+	require.Equal(t, id, fields["gorm"].(map[string]interface{})["correlation_id"])
+	require.Contains(t, fields["gorm"], "severity")
+	require.NotContains(t, fields, "correlation_id")
+	require.NotContains(t, fields, "severity")
+}
+
+func TestDedupFields(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.Context = func(context.Context) []zapcore.Field { return []zapcore.Field{zap.String("trace_id", "ctx")} }
+	logger.ErrorFields = func(context.Context, string, int64, time.Duration, string, error) []zapcore.Field {
+		return []zapcore.Field{zap.String("trace_id", "query")}
+	}
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	logger.DedupFields = true
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	countKey := func(entry observer.LoggedEntry) int {
+		n := 0
+		for _, f := range entry.Context {
+			if f.Key == "trace_id" {
+				n++
+			}
+		}
+		return n
+	}
+	require.Equal(t, 2, countKey(logs.All()[0]))
+	require.Equal(t, 1, countKey(logs.All()[1]))
+	require.Equal(t, "query", logs.All()[1].ContextMap()["trace_id"])
+	require.Equal(t, "boom", logs.All()[1].ContextMap()["error"])
+
+	shared := make([]zapcore.Field, 1, 8)
+	shared[0] = zap.String("trace_id", "ctx")
+	logger.Context = func(context.Context) []zapcore.Field { return shared }
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	_, _, _ = logger.RenderTrace(time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, zapcore.Field{}, shared[:2][1], "the slice returned by Context is not written to")
+}
+
+func TestGenerateCorrelationID(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.GenerateCorrelationID = true
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	ctx := zapgorm2.ContextWithCorrelationID(context.Background())
+	require.Equal(t, ctx, zapgorm2.ContextWithCorrelationID(ctx))
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	logger.Trace(zapgorm2.ContextWithCorrelationID(context.Background()), time.Now(), fc, errors.New("boom"))
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 4, logs.Len())
+	id, ok := zapgorm2.CorrelationIDFromContext(ctx)
+	require.True(t, ok)
+	require.Len(t, id, 16)
+	require.Equal(t, id, logs.All()[0].ContextMap()["correlation_id"])
+	require.Equal(t, id, logs.All()[1].ContextMap()["correlation_id"])
+	require.NotEqual(t, id, logs.All()[2].ContextMap()["correlation_id"])
+	require.NotContains(t, logs.All()[3].ContextMap(), "correlation_id")
+
+	logger.Context = func(context.Context) []zapcore.Field {
+		return []zapcore.Field{zap.String("correlation_id", "upstream")}
+	}
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 1, logs.FilterField(zap.String("correlation_id", "upstream")).Len())
+	require.Equal(t, "upstream", logs.All()[4].ContextMap()["correlation_id"])
+	require.Equal(t, 1, strings.Count(fmt.Sprint(logs.All()[4].Context), "correlation_id"))
+}
+
+func TestDiagnoseConfig(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.DiagnoseConfig = true
+	logger.SlowThreshold = time.Minute
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	long, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	logger.Trace(long, time.Now(), fc, nil)
+	require.Equal(t, 0, logs.Len())
+
+	short, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	logger.Trace(zapgorm2.ContextSilenced(short), time.Now(), fc, nil)
+	require.Equal(t, 0, logs.Len(), "silenced contexts are not diagnosed")
+	logger.Trace(short, time.Now(), fc, nil)
+	logger.Trace(short, time.Now(), fc, nil)
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, zap.DebugLevel, logs.All()[0].Level)
+	require.Equal(t, "slow threshold exceeds context deadline", logs.All()[0].Message)
+	require.Equal(t, time.Minute, logs.All()[0].ContextMap()["slow_threshold"])
+}
+
+func TestMaskColumns(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogSQLArgs = true
+	logger.MaskColumns = []string{"email", "ssn"}
+	db := openDryRunDB(t, logger)
+
+	var users []testUser
+	db.Where("users.email = ? AND name = ?", "alice@example.com", "alice").Find(&users)
+	db.Where("`email` IN ? AND id = ?", []string{"a@example.com", "b@example.com"}, 42).Find(&users)
+	require.Equal(t, 2, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, "SELECT * FROM `test_users` WHERE users.email = *** AND name = 'alice'", fields["sql"])
+	require.Equal(t, `["***","alice"]`, fields["args"])
+	fields = logs.All()[1].ContextMap()
+	require.Equal(t, "SELECT * FROM `test_users` WHERE `email` IN (***,***) AND id = 42", fields["sql"])
+	require.Equal(t, `["***","***",42]`, fields["args"])
+
+	zaplogger, logs := setupLogsCapture()
+	logger = zapgorm2.New(zaplogger)
+	logger.MaskColumns = []string{"ssn"}
+	fc := func() (string, int64) {
+		return "UPDATE users SET ssn = '123-45-6789' WHERE ssn NOT IN ('1', 2) AND ssn <> '3'", 0
+	}
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, "UPDATE users SET ssn = *** WHERE ssn NOT IN (***, ***) AND ssn <> '3'", logs.All()[0].ContextMap()["sql"])
+}
+
+type upperRedactor struct{ calls *int }
+
+func (r upperRedactor) Redact(sql string) string {
+	*r.calls++
+	return strings.ToUpper(sql)
+}
+
+func TestRedactor(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.RedactSQL = true
+	ctx := context.Background()
+	fc := func() (string, int64) {
+		return "SELECT * FROM t2 WHERE email = 'it''s@example.com' AND age > 42.5 AND id IN (1, 2)", 0
+	}
+
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, "SELECT * FROM t2 WHERE email = ? AND age > ? AND id IN (?, ?)", logs.All()[0].ContextMap()["sql"])
+
+	var calls int
+	logger.Redactor = upperRedactor{calls: &calls}
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 1, calls)
+	require.Equal(t, "SELECT * FROM T2 WHERE EMAIL = 'IT''S@EXAMPLE.COM' AND AGE > 42.5 AND ID IN (1, 2)", logs.All()[1].ContextMap()["sql"])
+
+	logger.RedactSQL = false
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 1, calls, "the Redactor is only used with RedactSQL")
+}
+
+func TestInlineParamsForDebug(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.InlineParamsForDebug = true
+	db := openDryRunDB(t, logger)
+
+	var (
+		users []testUser
+		email *string
+	)
+	db.Where("name = ? AND id IN ? AND score > ? AND email = ? AND deleted_at IS ?", "o'neil", []int{1, 2}, 1.5, email, nil).Find(&users)
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, "SELECT * FROM `test_users` WHERE name = 'o''neil' AND id IN (1,2) AND score > 1.5 AND email = NULL AND deleted_at IS NULL", fields["sql_inlined"])
+	require.NotContains(t, fields, "args")
+
+	db.Where("name = ?", (*sql.NullString)(nil)).Find(&users)
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "SELECT * FROM `test_users` WHERE name = NULL", logs.All()[1].ContextMap()["sql_inlined"])
+
+	logger.RedactSQL = true
+	db = openDryRunDB(t, logger)
+	db.Where("name = ? AND id = ?", "o'neil", 42).Find(&users)
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, "SELECT * FROM `test_users` WHERE name = ? AND id = ?", logs.All()[2].ContextMap()["sql_inlined"])
+
+	logger.SQLMode = zapgorm2.SQLModeHashOnly
+	db = openDryRunDB(t, logger)
+	db.Where("name = ?", "o'neil").Find(&users)
+	require.Equal(t, 4, logs.Len())
+	require.NotContains(t, logs.All()[3].ContextMap(), "sql_inlined", "SQLModeHashOnly logs no SQL text")
+}
+
+func TestOperationLevels(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.OperationLevels = map[string]zapcore.Level{
+		"INSERT": zapcore.InfoLevel,
+		"UPDATE": zapcore.InfoLevel,
+	}
+
+	for _, sql := range []string{"INSERT INTO users (name) VALUES ('alice')", "SELECT * FROM users", "/* app */ update users SET name = 'bob'"} {
+		sql := sql
+		logger.Trace(context.Background(), time.Now(), func() (string, int64) { return sql, 1 }, nil)
+	}
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, zapcore.InfoLevel, logs.All()[0].Level)
+	require.Equal(t, zapcore.DebugLevel, logs.All()[1].Level)
+	require.Equal(t, zapcore.InfoLevel, logs.All()[2].Level)
+}
+
+func TestMinLogDuration(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.SlowThreshold = time.Hour
+	logger.MinLogDuration = 50 * time.Millisecond
+	metrics := 0
+	logger.Metrics = func(context.Context, zapgorm2.TraceInfo) { metrics++ }
+	ctx := context.Background()
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(ctx, time.Now(), fc, nil)
+	logger.Trace(ctx, time.Now().Add(-time.Second), fc, nil)
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 3, metrics)
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, zapcore.DebugLevel, logs.All()[0].Level)
+	require.Equal(t, "query", logs.All()[0].ContextMap()["gorm_event"])
+	require.Equal(t, "error", logs.All()[1].ContextMap()["gorm_event"])
+}
+
+func TestFieldMask(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger.WithOptions(zap.AddCaller()))
+	logger.CallerFormat = zapgorm2.CallerFormatBase
+	fc := func() (string, int64) { return "SELECT ?", 3 }
+	keys := func(entry observer.LoggedEntry) []string {
+		var keys []string
+		for _, f := range entry.Context {
+			keys = append(keys, f.Key)
+		}
+		return keys
+	}
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	logger.Fields = 0
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	logger.Fields = zapgorm2.FieldSQL | zapgorm2.FieldElapsed | zapgorm2.FieldParamCount
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	logger.LogBeginTime = true
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 4, logs.Len())
+	require.Equal(t, []string{"sql", "rows", "elapsed", "caller", "error", "gorm_event"}, keys(logs.All()[0]))
+	require.Equal(t, keys(logs.All()[0]), keys(logs.All()[1]), "zero is FieldsDefault")
+	require.Equal(t, []string{"sql", "elapsed", "param_count"}, keys(logs.All()[2]))
+	require.Equal(t, []string{"sql", "elapsed", "begin", "param_count"}, keys(logs.All()[3]))
+
+	require.True(t, zapgorm2.FieldMask(0).Has(zapgorm2.FieldSQL|zapgorm2.FieldCaller))
+	require.False(t, zapgorm2.FieldMask(0).Has(zapgorm2.FieldQueryTime))
+	require.False(t, zapgorm2.FieldSQL.Has(zapgorm2.FieldSQL|zapgorm2.FieldRows))
+}
+
+func TestCatalogMode(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.CatalogMode = true
+	ctx := context.Background()
+	slowBegin := time.Now().Add(-time.Second)
+	trace := func(sql string, err error) {
+		logger.Trace(ctx, slowBegin, func() (string, int64) { return sql, 1 }, err)
+	}
+
+	trace("SELECT * FROM users WHERE id = 1", nil)
+	trace("SELECT * FROM users WHERE id = 2", nil)
+	trace("SELECT * FROM users WHERE id = 3", errors.New("boom"))
+	trace("SELECT * FROM orders WHERE id = 1", nil)
+	require.Equal(t, 4, logs.Len())
+	fingerprint := "SELECT * FROM users WHERE id = ?"
+	first := logs.All()[0].ContextMap()
+	require.Equal(t, "SELECT * FROM users WHERE id = 1", first["sql"])
+	require.Equal(t, fingerprint, first["fingerprint"])
+	subsequent := logs.All()[1].ContextMap()
+	require.NotContains(t, subsequent, "sql")
+	require.Equal(t, fingerprint, subsequent["fingerprint"])
+	failed := logs.All()[2].ContextMap()
+	require.Equal(t, "SELECT * FROM users WHERE id = 3", failed["sql"], "errors always include the SQL")
+	require.Equal(t, fingerprint, failed["fingerprint"])
+	require.Equal(t, "SELECT * FROM orders WHERE id = 1", logs.All()[3].ContextMap()["sql"])
+
+	logger.LogLevel = gormlogger.Info
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM accounts WHERE id = 1", 1 }, nil)
+	require.Equal(t, 4, logs.Len(), "the core drops the debug entries")
+	trace("SELECT * FROM accounts WHERE id = 2", nil)
+	require.Equal(t, 5, logs.Len())
+	require.Equal(t, "SELECT * FROM accounts WHERE id = 2", logs.All()[4].ContextMap()["sql"], "dropped entries are not catalogued")
+	logger.LogLevel = gormlogger.Warn
+
+	logger.SQLMode = zapgorm2.SQLModeHashOnly
+	trace("SELECT * FROM users WHERE id = 4", nil)
+	require.Equal(t, 6, logs.Len())
+	hashOnly := logs.All()[5].ContextMap()
+	require.Equal(t, zapgorm2.SQLHash("SELECT * FROM users WHERE id = 4"), hashOnly["sql_hash"])
+	require.NotContains(t, hashOnly, "fingerprint", "SQLModeHashOnly logs no SQL text")
+}
+
+func TestExpectedMaxRows(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.ExpectedMaxRows = map[string]int64{"SELECT * FROM users WHERE email = ? LIMIT ?": 1}
+	ctx := context.Background()
+	trace := func(sql string, rows int64) {
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return sql, rows }, nil)
+	}
+
+	trace("SELECT * FROM users WHERE email = 'a@example.com' LIMIT 10", 3)
+	trace("SELECT * FROM users WHERE email = 'b@example.com' LIMIT 10", 1)
+	trace("SELECT * FROM users", 3)
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	require.Equal(t, zapcore.WarnLevel, entry.Level)
+	require.Equal(t, "more rows than expected", entry.Message)
+	require.Equal(t, "too_many_rows", entry.ContextMap()["gorm_event"])
+	require.Equal(t, int64(3), entry.ContextMap()["rows"])
+	require.Equal(t, int64(1), entry.ContextMap()["expected_max_rows"])
+}
+
+func TestResultBytesFromContext(t *testing.T) {
+	type resultBytesKey struct{}
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.ResultBytesFromContext = func(ctx context.Context) (int64, bool) {
+		n, ok := ctx.Value(resultBytesKey{}).(int64)
+		return n, ok
+	}
+	logger.LargeResultBytes = 1 << 20
+	trace := func(ctx context.Context) {
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT body FROM documents", 2 }, errors.New("boom"))
+	}
+
+	trace(context.WithValue(context.Background(), resultBytesKey{}, int64(512)))
+	trace(context.Background())
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, int64(512), logs.All()[0].ContextMap()["result_bytes"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "result_bytes")
+
+	logger.LogLevel = gormlogger.Warn
+	ctx := context.WithValue(context.Background(), resultBytesKey{}, int64(4<<20))
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT body FROM documents", 2 }, nil)
+	ctx = context.WithValue(context.Background(), resultBytesKey{}, int64(1<<20))
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT body FROM documents", 2 }, nil)
+	require.Equal(t, 3, logs.Len())
+	entry := logs.All()[2]
+	require.Equal(t, zapcore.WarnLevel, entry.Level)
+	require.Equal(t, "large result", entry.Message)
+	require.Equal(t, "large_result", entry.ContextMap()["gorm_event"])
+	require.Equal(t, int64(4<<20), entry.ContextMap()["result_bytes"])
+}
+
+func TestTempUsageFromContext(t *testing.T) {
+	type tempUsageKey struct{}
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.TempUsageFromContext = func(ctx context.Context) (int64, bool) {
+		n, ok := ctx.Value(tempUsageKey{}).(int64)
+		return n, ok
+	}
+	logger.LargeTempBytes = 64 << 20
+	trace := func(ctx context.Context, err error) {
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM events ORDER BY payload", 10 }, err)
+	}
+
+	trace(context.WithValue(context.Background(), tempUsageKey{}, int64(8192)), errors.New("boom"))
+	trace(context.Background(), errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, int64(8192), logs.All()[0].ContextMap()["temp_bytes"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "temp_bytes")
+
+	trace(context.WithValue(context.Background(), tempUsageKey{}, int64(128<<20)), nil)
+	trace(context.WithValue(context.Background(), tempUsageKey{}, int64(64<<20)), nil)
+	require.Equal(t, 3, logs.Len())
+	entry := logs.All()[2]
+	require.Equal(t, zapcore.WarnLevel, entry.Level)
+	require.Equal(t, "query spilled to disk", entry.Message)
+	require.Equal(t, "large_temp_usage", entry.ContextMap()["gorm_event"])
+	require.Equal(t, int64(128<<20), entry.ContextMap()["temp_bytes"])
+}
+
+func TestConditionalFields(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.ConditionalFields = []zapgorm2.ConditionalField{{
+		When:  func(info zapgorm2.TraceInfo) bool { return info.Operation == "DELETE" && info.Rows > 1000 },
+		Field: func(info zapgorm2.TraceInfo) zapcore.Field { return zap.Bool("risky", true) },
+	}, {
+		When: func(info zapgorm2.TraceInfo) bool { return info.Slow },
+		Field: func(info zapgorm2.TraceInfo) zapcore.Field {
+			return zap.Duration("over", info.Elapsed-info.SlowThreshold)
+		},
+	}}
+	trace := func(begin time.Time, sql string, rows int64) {
+		logger.Trace(context.Background(), begin, func() (string, int64) { return sql, rows }, errors.New("boom"))
+	}
+
+	trace(time.Now(), "DELETE FROM sessions WHERE expired", 5000)
+	trace(time.Now(), "DELETE FROM sessions WHERE id = 1", 1)
+	trace(time.Now(), "SELECT * FROM sessions", 5000)
+	trace(time.Now().Add(-time.Second), "delete from sessions where expired", 2000)
+	require.Equal(t, 4, logs.Len())
+	require.Equal(t, true, logs.All()[0].ContextMap()["risky"])
+	require.NotContains(t, logs.All()[0].ContextMap(), "over")
+	require.NotContains(t, logs.All()[1].ContextMap(), "risky")
+	require.NotContains(t, logs.All()[2].ContextMap(), "risky")
+	fields := logs.All()[3].Context
+	require.Equal(t, "risky", fields[len(fields)-2].Key, "the rules are evaluated in order")
+	require.Equal(t, "over", fields[len(fields)-1].Key)
+
+	always := func(zapgorm2.TraceInfo) bool { return true }
+	logger.ConditionalFields = append(logger.ConditionalFields, zapgorm2.ConditionalField{When: always}, zapgorm2.ConditionalField{})
+	trace(time.Now(), "DELETE FROM sessions WHERE expired", 5000)
+	require.Equal(t, 5, logs.Len(), "the incomplete rules are skipped")
+	require.Equal(t, true, logs.All()[4].ContextMap()["risky"])
+}
+
+func TestTraceFieldOrder(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger.WithOptions(zap.AddCaller()))
+	logger.Context = func(context.Context) []zapcore.Field { return []zapcore.Field{zap.String("trace_id", "t1")} }
+	logger.GenerateCorrelationID = true
+	logger.Version = "v1.0.0"
+	logger.Host, logger.Port = "db", 5432
+	logger.CallerFormat = zapgorm2.CallerFormatBase
+	logger.LogQueryTime = true
+	logger.LogParamCount = true
+	logger.QueryIDFunc = func(string) string { return "q1" }
+	logger.ErrorFields = func(context.Context, string, int64, time.Duration, string, error) []zapcore.Field {
+		return []zapcore.Field{zap.String("extra", "x")}
+	}
+	logger.LogEffectiveLevel = true
+	ctx := zapgorm2.ContextWithCorrelationID(context.Background())
+	fc := func() (string, int64) { return "SELECT ?", 1 }
+
+	for i := 0; i < 3; i++ {
+		logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	}
+	require.Equal(t, 3, logs.Len())
+	expected := []string{
+		"trace_id", "correlation_id", "app_version", "db_host", "db_port",
+		"sql", "rows", "elapsed", "caller", "error", "gorm_event",
+		"query_time", "param_count", "query_id",
+		"extra", "effective_level",
+	}
+	for _, entry := range logs.All() {
+		var keys []string
+		for _, f := range entry.Context {
+			keys = append(keys, f.Key)
+		}
+		require.Equal(t, expected, keys)
+	}
+}
+
+func TestLogIfTraceSampled(t *testing.T) {
+	type sampledKey struct{}
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogIfTraceSampled = true
+	logger.TraceSampled = func(ctx context.Context) (bool, bool) {
+		sampled, ok := ctx.Value(sampledKey{}).(bool)
+		return sampled, ok
+	}
+	sampled := context.WithValue(context.Background(), sampledKey{}, true)
+	unsampled := context.WithValue(context.Background(), sampledKey{}, false)
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(sampled, time.Now(), fc, nil)
+	logger.Trace(unsampled, time.Now(), fc, nil)
+	logger.Trace(unsampled, time.Now().Add(-time.Second), fc, nil)
+	logger.Trace(unsampled, time.Now(), fc, errors.New("boom"))
+	logger.Trace(context.Background(), time.Now(), fc, nil)
+	require.Equal(t, 4, logs.Len())
+	var events []interface{}
+	for _, entry := range logs.All() {
+		events = append(events, entry.ContextMap()["gorm_event"])
+	}
+	require.Equal(t, []interface{}{"query", "slow_query", "error", "query"}, events)
+}
+
+func TestTraceFields(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.CallerFormat = zapgorm2.CallerFormatBase
+	logger.Metrics = func(context.Context, zapgorm2.TraceInfo) { t.Fatal("TraceFields called Metrics") }
+	fc := func() (string, int64) { return "SELECT 1", 3 }
+
+	fields := logger.TraceFields(time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 0, logs.Len())
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	require.Equal(t, "boom", enc.Fields["error"])
+	require.Equal(t, int64(3), enc.Fields["rows"])
+	require.Equal(t, "SELECT 1", enc.Fields["sql"])
+	require.Equal(t, "error", enc.Fields["gorm_event"])
+	require.Contains(t, enc.Fields, "elapsed")
+	require.Regexp(t, `^testing\.go:\d+$`, enc.Fields["caller"])
+
+	fields = logger.TraceFields(time.Now().Add(-time.Second), fc, nil)
+	require.Contains(t, fields, zap.String("gorm_event", "slow_query"))
+
+	logger.LogLevel = gormlogger.Silent
+	logger.Enabled = func() bool { return false }
+	logger.MinLogDuration = time.Hour
+	fields = logger.TraceFields(time.Now(), fc, errors.New("boom"))
+	require.Contains(t, fields, zap.String("gorm_event", "error"))
+	fields = logger.TraceFields(time.Now(), fc, nil)
+	require.Contains(t, fields, zap.String("gorm_event", "query"))
+
+	logger.IsPoolError = func(error) bool { return true }
+	fields = logger.TraceFields(time.Now(), fc, errors.New("pool exhausted"))
+	require.Contains(t, fields, zap.Bool("pool_exhausted", true))
+}
+
+func TestRenderTrace(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*zapgorm2.Logger)
+		begin     time.Time
+		err       error
+	}{
+		{"error", func(l *zapgorm2.Logger) {}, time.Now(), errors.New("boom")},
+		{"slow", func(l *zapgorm2.Logger) {
+			l.CallerFormat = zapgorm2.CallerFormatBase
+			l.Context = func(context.Context) []zapcore.Field { return []zapcore.Field{zap.String("service", "api")} }
+			l.SeverityField = true
+		}, time.Now().Add(-time.Second), nil},
+		{"query", func(l *zapgorm2.Logger) {
+			l.LogLevel = gormlogger.Info
+			l.Namespace = "db"
+			l.LogEffectiveLevel = true
+			l.DedupFields = true
+			l.Context = func(context.Context) []zapcore.Field { return []zapcore.Field{zap.String("rows", "ctx")} }
+		}, time.Now(), nil},
+		{"message function", func(l *zapgorm2.Logger) {
+			l.LogLevel = gormlogger.Info
+			l.QueryMsgFn = func(info zapgorm2.TraceInfo) string { return fmt.Sprintf("[rows:%d] %s", info.Rows, info.SQL) }
+		}, time.Now(), nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zap.DebugLevel)
+			logger := zapgorm2.New(zap.New(core))
+			tt.configure(&logger)
+			fc := func() (string, int64) { return "SELECT * FROM users WHERE id = 1", 1 }
+
+			level, msg, fields := logger.RenderTrace(tt.begin, fc, tt.err)
+			require.Equal(t, 0, logs.Len(), "RenderTrace logs nothing")
+			logger.Trace(context.Background(), tt.begin, fc, tt.err)
+			require.Equal(t, 1, logs.Len())
+			entry := logs.All()[0]
+			require.Equal(t, entry.Level, level)
+			require.Equal(t, entry.Message, msg)
+			withoutElapsed := func(fields []zapcore.Field) []zapcore.Field {
+				var kept []zapcore.Field
+				for _, f := range fields {
+					if f.Key != "elapsed" {
+						kept = append(kept, f)
+					}
+				}
+				return kept
+			}
+			require.Equal(t, withoutElapsed(entry.Context), withoutElapsed(fields))
+		})
+	}
+
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.CatalogMode = true
+	fc := func() (string, int64) { return "SELECT * FROM users WHERE id = 1", 1 }
+	_, msg, fields := logger.RenderTrace(time.Now(), fc, nil)
+	require.Equal(t, "", msg, "nothing is logged for a regular query at Warn level")
+	require.Nil(t, fields)
+	logger.RenderTrace(time.Now().Add(-time.Second), fc, nil)
+	logger.Trace(context.Background(), time.Now().Add(-time.Second), fc, nil)
+	require.Equal(t, 1, logs.Len())
+	require.Contains(t, logs.All()[0].ContextMap(), "sql", "RenderTrace does not record the fingerprints of CatalogMode")
+}
+
+func TestScannedRowsFromContext(t *testing.T) {
+	type scannedKey struct{}
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.ScannedRowsFromContext = func(ctx context.Context) (int64, bool) {
+		scanned, ok := ctx.Value(scannedKey{}).(int64)
+		return scanned, ok
+	}
+	fc := func() (string, int64) { return "SELECT * FROM users WHERE name LIKE '%a'", 3 }
+
+	logger.Trace(context.WithValue(context.Background(), scannedKey{}, int64(10000)), time.Now(), fc, errors.New("boom"))
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, int64(10000), fields["rows_scanned"])
+	require.Equal(t, int64(3), fields["rows_returned"])
+	require.Equal(t, int64(3), fields["rows"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "rows_scanned")
+	require.NotContains(t, logs.All()[1].ContextMap(), "rows_returned")
+}
+
+func TestRecoverContextFunc(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.RecoverContextFunc = true
+	logger.Context = func(ctx context.Context) []zapcore.Field {
+		return []zapcore.Field{zap.String("request_id", ctx.Value("request_id").(string))}
+	}
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, zap.DebugLevel, logs.All()[0].Level)
+	require.Equal(t, "context function panicked", logs.All()[0].Message)
+	require.Equal(t, zap.ErrorLevel, logs.All()[1].Level)
+	require.NotContains(t, logs.All()[1].ContextMap(), "request_id")
+
+	logger.RecoverContextFunc = false
+	require.Panics(t, func() { logger.Trace(context.Background(), time.Now(), fc, errors.New("boom")) })
+}
+
+func TestConnWaitFromContext(t *testing.T) {
+	type connWaitKey struct{}
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.ConnWaitFromContext = func(ctx context.Context) (time.Duration, bool) {
+		wait, ok := ctx.Value(connWaitKey{}).(time.Duration)
+		return wait, ok
+	}
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	ctx := context.WithValue(context.Background(), connWaitKey{}, 300*time.Millisecond)
+	logger.Trace(ctx, time.Now().Add(-time.Second), fc, errors.New("boom"))
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, 300*time.Millisecond, fields["conn_wait"])
+	require.Equal(t, fields["elapsed"].(time.Duration)-300*time.Millisecond, fields["db_time"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "conn_wait")
+	require.NotContains(t, logs.All()[1].ContextMap(), "db_time")
+}
+
+func TestConnAcquiredFromContext(t *testing.T) {
+	type connAcquiredKey struct{}
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.ConnAcquiredFromContext = func(ctx context.Context) (time.Time, bool) {
+		acquired, ok := ctx.Value(connAcquiredKey{}).(time.Time)
+		return acquired, ok
+	}
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+	acquired := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	ctx := context.WithValue(context.Background(), connAcquiredKey{}, acquired)
+	logger.Trace(ctx, acquired.Add(time.Millisecond), fc, errors.New("boom"))
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, acquired, logs.All()[0].ContextMap()["conn_acquired_at"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "conn_acquired_at")
+}
+
+func TestLockWaitFromContext(t *testing.T) {
+	type lockWaitKey struct{}
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.LockWaitFromContext = func(ctx context.Context) (time.Duration, bool) {
+		wait, ok := ctx.Value(lockWaitKey{}).(time.Duration)
+		return wait, ok
+	}
+	logger.LockContendedThreshold = 100 * time.Millisecond
+	fc := func() (string, int64) { return "UPDATE accounts SET balance = 0 WHERE id = 1", 1 }
+	slowBegin := time.Now().Add(-time.Second)
+
+	logger.Trace(context.WithValue(context.Background(), lockWaitKey{}, 800*time.Millisecond), slowBegin, fc, nil)
+	logger.Trace(context.WithValue(context.Background(), lockWaitKey{}, 10*time.Millisecond), slowBegin, fc, nil)
+	logger.Trace(context.Background(), slowBegin, fc, nil)
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, 800*time.Millisecond, logs.All()[0].ContextMap()["lock_wait"])
+	require.Equal(t, true, logs.All()[0].ContextMap()["lock_contended"])
+	require.Equal(t, 10*time.Millisecond, logs.All()[1].ContextMap()["lock_wait"])
+	require.Equal(t, false, logs.All()[1].ContextMap()["lock_contended"])
+	require.NotContains(t, logs.All()[2].ContextMap(), "lock_wait")
+	require.NotContains(t, logs.All()[2].ContextMap(), "lock_contended")
+}
+
+func TestSearchPathFromContext(t *testing.T) {
+	type searchPathKey struct{}
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.SearchPathFromContext = func(ctx context.Context) (string, bool) {
+		sp, ok := ctx.Value(searchPathKey{}).(string)
+		return sp, ok
+	}
+	fc := func() (string, int64) { return "SELECT * FROM users", 1 }
+
+	ctx := context.WithValue(context.Background(), searchPathKey{}, "tenant_42, public")
+	logger.Trace(ctx, time.Now(), fc, errors.New("boom"))
+	logger.Trace(context.Background(), time.Now(), fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, "tenant_42, public", logs.All()[0].ContextMap()["search_path"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "search_path")
+}
+
+func TestNormalizeKeywordCase(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.SQLMode = zapgorm2.SQLModeHashOnly
+	logger.NormalizeKeywordCase = true
+	logger.KeepRecent = 3
+	ctx := context.Background()
+	trace := func(sql string) {
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return sql, 1 }, errors.New("boom"))
+	}
+
+	trace("select id from users where name = 'select' and `from` = 1")
+	trace("SELECT id FROM users WHERE name = 'bob' AND `from` = 2")
+	trace("SELECT ID FROM users WHERE name = 'bob' AND `FROM` = 2")
+	recent := logger.RecentQueries(0)
+	require.Equal(t, "SELECT id FROM users WHERE name = ? AND `from` = ?", recent[0].Fingerprint)
+	require.Equal(t, recent[0].Fingerprint, recent[1].Fingerprint)
+	require.Equal(t, "SELECT ID FROM users WHERE name = ? AND `FROM` = ?", recent[2].Fingerprint, "identifiers are kept as is")
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, logs.All()[0].ContextMap()["sql_hash"], logs.All()[1].ContextMap()["sql_hash"])
+	require.NotEqual(t, logs.All()[0].ContextMap()["sql_hash"], logs.All()[2].ContextMap()["sql_hash"])
+}
+
+func TestWarnMissingWhere(t *testing.T) {
+	tests := []struct {
+		sql   string
+		event string
+	}{
+		{"DELETE FROM `users`", "missing_where"},
+		{"UPDATE users SET note = 'where?' -- WHERE id = 1", "missing_where"},
+		{"UPDATE users SET name = 'bob' WHERE id = 1", ""},
+		{"DELETE FROM sessions /* zapgorm2:full-table */", ""},
+		{"SELECT * FROM users", ""},
+	}
+	for _, tt := range tests {
+		zaplogger, logs := setupLogsCapture()
+		logger := zapgorm2.New(zaplogger)
+		logger.WarnMissingWhere = true
+		sql := tt.sql
+		logger.Trace(context.Background(), time.Now(), func() (string, int64) { return sql, 1 }, nil)
+		if tt.event == "" {
+			require.Equal(t, 0, logs.Len(), tt.sql)
+			continue
+		}
+		require.Equal(t, 1, logs.Len(), tt.sql)
+		require.Equal(t, zap.WarnLevel, logs.All()[0].Level)
+		require.Equal(t, "write without where clause", logs.All()[0].Message)
+		require.Equal(t, tt.event, logs.All()[0].ContextMap()["gorm_event"])
+	}
+}
+
+func TestLogEffectiveLevel(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core)).LogMode(gormlogger.Info).(zapgorm2.Logger)
+	logger.LogEffectiveLevel = true
+	logger.OperationLevels = map[string]zapcore.Level{"INSERT": zapcore.InfoLevel}
+	ctx := context.Background()
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, nil)
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "INSERT INTO users VALUES (1)", 1 }, nil)
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+	logger.ShutdownMode()
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+	require.Equal(t, 4, logs.Len())
+	for i, level := range []string{"debug", "info", "error", "debug"} {
+		require.Equal(t, level, logs.All()[i].ContextMap()["effective_level"])
+		require.Equal(t, level, logs.All()[i].Level.String())
+	}
+}
+
+func TestNearDeadlineMargin(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.SlowThreshold = 0
+	logger.NearDeadlineMargin = 100 * time.Millisecond
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	begin := time.Now().Add(-950 * time.Millisecond)
+	near, cancel := context.WithDeadline(context.Background(), begin.Add(time.Second))
+	defer cancel()
+	far, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	logger.Trace(near, begin, fc, nil)
+	logger.Trace(far, time.Now(), fc, nil)
+	logger.Trace(context.Background(), begin, fc, errors.New("boom"))
+	require.Equal(t, 2, logs.Len())
+	require.Equal(t, zap.WarnLevel, logs.All()[0].Level)
+	require.Equal(t, true, logs.All()[0].ContextMap()["near_deadline"])
+	require.NotContains(t, logs.All()[1].ContextMap(), "near_deadline")
+}
+
+func TestRowsMode(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.RowsMode = zapgorm2.RowsModeSkipRaw
+	db := openDryRunDB(t, logger)
+
+	db.WithContext(zapgorm2.ContextForRawSQL(context.Background())).Exec("UPDATE users SET name = ?", "bob")
+	db.Find(&[]testUser{})
+	require.Equal(t, 2, logs.Len())
+	require.NotContains(t, logs.All()[0].ContextMap(), "rows")
+	require.Contains(t, logs.All()[1].ContextMap(), "rows")
+
+	logger.RowsFunc = func(ctx context.Context, sql string) bool { return !strings.HasPrefix(sql, "SELECT") }
+	db = openDryRunDB(t, logger)
+	db.Find(&[]testUser{})
+	require.Equal(t, 3, logs.Len())
+	require.NotContains(t, logs.All()[2].ContextMap(), "rows")
+}
+
+func TestLogArgsSummary(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogArgsSummary = true
+	db := openDryRunDB(t, logger)
+
+	var (
+		users []testUser
+		email *string
+	)
+	db.Where("name = ? AND id = ? AND score > ? AND email = ? AND active = ? AND created_at < ?",
+		"alice@example.com", 42, 1.5, email, true, time.Now()).Find(&users)
+	ids := make([]int, 40)
+	db.Where("id IN ?", ids).Find(&users)
+	require.Equal(t, 2, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, "string(17), int, float, null, bool, time", fields["args_summary"])
+	require.NotContains(t, fields, "args")
+	require.Equal(t, strings.Repeat("int, ", 31)+"int, ... (8 more)", logs.All()[1].ContextMap()["args_summary"])
+
+	db.Where("name = ?", (*sql.NullString)(nil)).Find(&users)
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, "null", logs.All()[2].ContextMap()["args_summary"])
+}
+
+func TestIsPoolError(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.IsPoolError = zapgorm2.DefaultIsPoolError
+	var exhausted int
+	logger.OnPoolExhausted = func(context.Context, error) { exhausted++ }
+	fc := func() (string, int64) { return "SELECT 1", 0 }
+	ctx := context.Background()
+
+	logger.Trace(ctx, time.Now(), fc, errors.New("Error 1040: Too many connections"))
+	logger.Trace(ctx, time.Now(), fc, errors.New("pq: sorry, too many clients already"))
+	logger.Trace(ctx, time.Now(), fc, errors.New("syntax error"))
+	require.Equal(t, 3, logs.Len())
+	for _, entry := range logs.All()[:2] {
+		require.Equal(t, zap.WarnLevel, entry.Level)
+		require.Equal(t, true, entry.ContextMap()["pool_exhausted"])
+	}
+	require.Equal(t, zap.ErrorLevel, logs.All()[2].Level)
+	require.NotContains(t, logs.All()[2].ContextMap(), "pool_exhausted")
+	require.Equal(t, 1, exhausted, "OnPoolExhausted is called once per interval")
+
+	logger.PoolExhaustedInterval = 0
+	logger.Trace(ctx, time.Now(), fc, errors.New("Error 1040: Too many connections"))
+	require.Equal(t, 2, exhausted)
+}
+
+func TestLogParamsHash(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogParamsHash = true
+	db := openDryRunDB(t, logger)
+
+	var users []testUser
+	db.Where("name = ? AND id > ?", "alice", 42).Find(&users)
+	db.Where("name = ? AND id > ?", "alice", 42).Find(&users)
+	db.Where("name = ? AND id > ?", "bob", 42).Find(&users)
+	db.Find(&users)
+	db.Where("1 = 1").Find(&users)
+	require.Equal(t, 5, logs.Len())
+	hash := func(i int) string { return logs.All()[i].ContextMap()["params_hash"].(string) }
+	require.Len(t, hash(0), 64)
+	require.Equal(t, hash(0), hash(1))
+	require.NotEqual(t, hash(0), hash(2))
+	require.Equal(t, hash(3), hash(4), "queries without args share a constant hash")
+	require.NotContains(t, logs.All()[0].ContextMap(), "args")
+
+	db.Where("name = ?", (*sql.NullString)(nil)).Find(&users)
+	require.Equal(t, 6, logs.Len())
+	require.Len(t, hash(5), 64)
+}
+
+func TestLongTxnThreshold(t *testing.T) {
+	zaplogger, logs := setupLogsCapture()
+	logger := zapgorm2.New(zaplogger)
+	logger.SlowThreshold = 0
+	logger.LongTxnThreshold = time.Second
+	sql := func(sql string) func() (string, int64) { return func() (string, int64) { return sql, 0 } }
+
+	fast := zapgorm2.ContextWithTransaction(context.Background())
+	logger.Trace(fast, time.Now(), sql("BEGIN"), nil)
+	logger.Trace(fast, time.Now(), sql("COMMIT"), nil)
+	require.Equal(t, 0, logs.Len())
+
+	slow := zapgorm2.ContextWithTransaction(context.Background())
+	logger.Trace(slow, time.Now().Add(-2*time.Second), sql("BEGIN"), nil)
+	logger.Trace(slow, time.Now(), sql("ROLLBACK"), nil)
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	require.Equal(t, zap.WarnLevel, entry.Level)
+	require.Equal(t, "long transaction", entry.Message)
+	require.Equal(t, "long_transaction", entry.ContextMap()["gorm_event"])
+	require.GreaterOrEqual(t, entry.ContextMap()["txn_duration"].(time.Duration), 2*time.Second)
+
+	logger.Trace(slow, time.Now(), sql("COMMIT"), nil)
+	require.Equal(t, 1, logs.Len(), "the transaction already ended")
+
+	savepoint := zapgorm2.ContextWithTransaction(context.Background())
+	logger.Trace(savepoint, time.Now().Add(-2*time.Second), sql("BEGIN"), nil)
+	logger.Trace(savepoint, time.Now(), sql("SAVEPOINT sp1"), nil)
+	logger.Trace(savepoint, time.Now(), sql("ROLLBACK TO SAVEPOINT sp1"), nil)
+	logger.Trace(savepoint, time.Now(), sql("RELEASE SAVEPOINT sp1"), nil)
+	logger.Trace(savepoint, time.Now(), sql("rollback work to sp1"), nil)
+	require.Equal(t, 1, logs.Len(), "savepoints do not end the transaction")
+	logger.Trace(savepoint, time.Now(), sql("COMMIT"), nil)
+	require.Equal(t, 2, logs.Len())
+	require.GreaterOrEqual(t, logs.All()[1].ContextMap()["txn_duration"].(time.Duration), 2*time.Second)
+}
+
+func TestLogInTransaction(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogInTransaction = true
+	ctx := zapgorm2.ContextWithTransaction(context.Background())
+	statements := []string{"SELECT 1", "BEGIN", "UPDATE users SET name = 'bob' WHERE id = 1", "COMMIT", "SELECT 2"}
+
+	for _, sql := range statements {
+		sql := sql
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return sql, 1 }, nil)
+	}
+	logger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 3", 1 }, nil)
+	require.Equal(t, 6, logs.Len())
+	var inTransaction []interface{}
+	for _, entry := range logs.All() {
+		inTransaction = append(inTransaction, entry.ContextMap()["in_transaction"])
+	}
+	require.Equal(t, []interface{}{false, true, true, true, false, false}, inTransaction)
+}
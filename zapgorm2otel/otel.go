@@ -0,0 +1,84 @@
+// Package zapgorm2otel records the queries traced by zapgorm2 as
+// OpenTelemetry metrics, and ties their logs to the sampling of traces. It is
+// a separate module, so that zapgorm2 does not depend on OpenTelemetry.
+package zapgorm2otel
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"moul.io/zapgorm2"
+)
+
+// NewMeterHook returns a zapgorm2.Logger Metrics callback recording with
+// meter:
+//
+//   - gorm.query.duration, a histogram of the query durations in seconds,
+//   - gorm.queries, a counter of the queries,
+//   - gorm.query.errors, a counter of the failed queries,
+//
+// with a db.operation attribute holding the TraceInfo Operation, and a
+// db.sql.table attribute parsed from the SQL on a best-effort basis.
+func NewMeterHook(meter metric.Meter) (func(ctx context.Context, info zapgorm2.TraceInfo), error) {
+	duration, err := meter.Float64Histogram("gorm.query.duration",
+		metric.WithDescription("Duration of the GORM queries."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	queries, err := meter.Int64Counter("gorm.queries",
+		metric.WithDescription("Number of GORM queries."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := meter.Int64Counter("gorm.query.errors",
+		metric.WithDescription("Number of failed GORM queries."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, info zapgorm2.TraceInfo) {
+		attrs := metric.WithAttributes(
+			attribute.String("db.operation", info.Operation),
+			attribute.String("db.sql.table", parseTable(info.SQL)),
+		)
+		duration.Record(ctx, info.Elapsed.Seconds(), attrs)
+		queries.Add(ctx, 1, attrs)
+		if info.Err != nil {
+			failures.Add(ctx, 1, attrs)
+		}
+	}, nil
+}
+
+// parseTable returns the table following the first FROM, INTO or UPDATE
+// keyword of sql, without quotes nor schema.
+func parseTable(sql string) string {
+	words := strings.Fields(sql)
+	for i := 0; i+1 < len(words); i++ {
+		switch strings.ToUpper(words[i]) {
+		case "FROM", "INTO", "UPDATE":
+			table := strings.Trim(words[i+1], "`\"[]();,")
+			if dot := strings.LastIndexByte(table, '.'); dot >= 0 {
+				table = strings.Trim(table[dot+1:], "`\"[]")
+			}
+			return table
+		}
+	}
+	return ""
+}
+
+// TraceSampled is a zapgorm2.Logger TraceSampled callback reporting whether
+// the span of ctx is sampled, for LogIfTraceSampled. ok is false when ctx has
+// no valid span context.
+func TraceSampled(ctx context.Context) (sampled bool, ok bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return false, false
+	}
+	return sc.IsSampled(), true
+}
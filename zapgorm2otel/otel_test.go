@@ -0,0 +1,88 @@
+package zapgorm2otel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	gormlogger "gorm.io/gorm/logger"
+	"moul.io/zapgorm2"
+	"moul.io/zapgorm2/zapgorm2otel"
+)
+
+func TestNewMeterHook(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	hook, err := zapgorm2otel.NewMeterHook(provider.Meter("test"))
+	require.NoError(t, err)
+
+	logger := zapgorm2.New(zap.NewNop())
+	logger.Metrics = hook
+	ctx := context.Background()
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM `users` WHERE id = 1", 1 }, nil)
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM `users` WHERE id = 2", 0 }, errors.New("boom"))
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "INSERT INTO public.orders (id) VALUES (1)", 1 }, nil)
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "/* app */ DELETE FROM orders WHERE id = 1", 1 }, nil)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	metrics := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m.Data
+	}
+
+	counts := map[string]int64{}
+	for _, dp := range metrics["gorm.queries"].(metricdata.Sum[int64]).DataPoints {
+		operation, _ := dp.Attributes.Value("db.operation")
+		table, _ := dp.Attributes.Value("db.sql.table")
+		counts[operation.AsString()+" "+table.AsString()] = dp.Value
+	}
+	require.Equal(t, map[string]int64{"SELECT users": 2, "INSERT orders": 1, "DELETE orders": 1}, counts)
+
+	failures := metrics["gorm.query.errors"].(metricdata.Sum[int64]).DataPoints
+	require.Len(t, failures, 1)
+	require.Equal(t, int64(1), failures[0].Value)
+
+	var observed uint64
+	for _, dp := range metrics["gorm.query.duration"].(metricdata.Histogram[float64]).DataPoints {
+		observed += dp.Count
+	}
+	require.Equal(t, uint64(4), observed)
+}
+
+func TestTraceSampled(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zapgorm2.New(zap.New(core))
+	logger.LogLevel = gormlogger.Info
+	logger.LogIfTraceSampled = true
+	logger.TraceSampled = zapgorm2otel.TraceSampled
+	spanContext := func(flags trace.TraceFlags) context.Context {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: flags,
+		})
+		return trace.ContextWithSpanContext(context.Background(), sc)
+	}
+	sampled, unsampled := spanContext(trace.FlagsSampled), spanContext(0)
+	traceSQL := func(ctx context.Context, sql string, err error) {
+		logger.Trace(ctx, time.Now(), func() (string, int64) { return sql, 1 }, err)
+	}
+
+	traceSQL(sampled, "SELECT 'sampled'", nil)
+	traceSQL(unsampled, "SELECT 'unsampled'", nil)
+	traceSQL(unsampled, "SELECT 'unsampled error'", errors.New("boom"))
+	traceSQL(context.Background(), "SELECT 'no trace'", nil)
+	require.Equal(t, 3, logs.Len())
+	require.Equal(t, "SELECT 'sampled'", logs.All()[0].ContextMap()["sql"])
+	require.Equal(t, "SELECT 'unsampled error'", logs.All()[1].ContextMap()["sql"])
+	require.Equal(t, "SELECT 'no trace'", logs.All()[2].ContextMap()["sql"])
+}
@@ -0,0 +1,50 @@
+// Package zapgorm2test provides helpers to check the GORM logs of tests.
+package zapgorm2test
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"moul.io/zapgorm2"
+)
+
+// Recorder records the entries of a zapgorm2.Logger returned by New.
+type Recorder struct {
+	logs *observer.ObservedLogs
+}
+
+// New returns a zapgorm2.Logger recording its entries at level or above,
+// and its Recorder.
+func New(level zapcore.LevelEnabler) (zapgorm2.Logger, *Recorder) {
+	core, logs := observer.New(level)
+	return zapgorm2.New(zap.New(core)), &Recorder{logs: logs}
+}
+
+// Logs returns the recorded entries.
+func (r *Recorder) Logs() *observer.ObservedLogs {
+	return r.logs
+}
+
+// ErrorCount returns the number of recorded entries at error level or above.
+func (r *Recorder) ErrorCount() int {
+	return len(r.errors())
+}
+
+// AssertNoErrors reports an error to t for each recorded entry at error
+// level or above, and returns whether there is none.
+func (r *Recorder) AssertNoErrors(t testing.TB) bool {
+	t.Helper()
+	errors := r.errors()
+	for _, entry := range errors {
+		t.Errorf("unexpected GORM %s log: %s %v", entry.Level, entry.Message, entry.ContextMap())
+	}
+	return len(errors) == 0
+}
+
+func (r *Recorder) errors() []observer.LoggedEntry {
+	return r.logs.Filter(func(entry observer.LoggedEntry) bool {
+		return entry.Level >= zapcore.ErrorLevel
+	}).All()
+}
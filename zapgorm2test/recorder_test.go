@@ -0,0 +1,42 @@
+package zapgorm2test_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"moul.io/zapgorm2/zapgorm2test"
+)
+
+// fakeT records the errors reported by the assertions.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	logger, recorder := zapgorm2test.New(zap.DebugLevel)
+	ctx := context.Background()
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, nil)
+	ft := &fakeT{TB: t}
+	require.True(t, recorder.AssertNoErrors(ft))
+	require.Empty(t, ft.errors)
+	require.Equal(t, 0, recorder.ErrorCount())
+
+	logger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+	require.Equal(t, 1, recorder.ErrorCount())
+	require.False(t, recorder.AssertNoErrors(ft))
+	require.Len(t, ft.errors, 1)
+	require.Contains(t, ft.errors[0], "boom")
+}